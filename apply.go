@@ -0,0 +1,437 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/pkg/errors"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrInvalidPatch    = errors.New("trigger: invalid patch")
+	ErrPatchTestFailed = errors.New("trigger: json patch test operation failed")
+)
+
+// MergeStrategy determines how the output of a trigger is applied to a Mapper
+type MergeStrategy int
+
+const (
+	// MergeShallow overwrites the top-level fields of the Mapper with the fields of the patch
+	MergeShallow MergeStrategy = iota
+	// MergeDeep recursively merges nested maps of the patch into the Mapper. Any other value overwrites.
+	MergeDeep
+	// MergeJSONMergePatch applies the patch as an RFC 7386 JSON Merge Patch: nested maps are merged recursively &
+	// a null value deletes the field
+	MergeJSONMergePatch
+	// MergeJSONPatch applies the output of the trigger as an RFC 6902 JSON Patch. The trigger must return a list of
+	// operations, ex: [{'op': 'remove', 'path': '/password'}, {'op': 'add', 'path': '/tags/-', 'value': 'new'}]
+	MergeJSONPatch
+)
+
+// String returns the name of the strategy
+func (s MergeStrategy) String() string {
+	switch s {
+	case MergeShallow:
+		return "shallow"
+	case MergeDeep:
+		return "deep"
+	case MergeJSONMergePatch:
+		return "json merge patch"
+	case MergeJSONPatch:
+		return "json patch"
+	}
+	return "unknown"
+}
+
+type applyOptions struct {
+	strategy MergeStrategy
+}
+
+// ApplyOption configures how a trigger is applied to a Mapper
+type ApplyOption func(o *applyOptions)
+
+// WithMergeStrategy sets how the output of the trigger is applied (default: MergeShallow)
+func WithMergeStrategy(strategy MergeStrategy) ApplyOption {
+	return func(o *applyOptions) {
+		o.strategy = strategy
+	}
+}
+
+// Apply executes the trigger against the Mapper & returns a copy of the Mapper with the trigger's output applied.
+// The Mapper is returned unchanged if the decision denies. The Mapper itself is never modified.
+func (t *Trigger) Apply(data map[string]interface{}, opts ...ApplyOption) (map[string]interface{}, error) {
+	return t.ApplyContext(context.Background(), data, opts...)
+}
+
+// ApplyContext is like Apply but evaluation is stopped once the context is done
+func (t *Trigger) ApplyContext(ctx context.Context, data map[string]interface{}, opts ...ApplyOption) (map[string]interface{}, error) {
+	options := &applyOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	out, err := t.eval(ctx, map[string]interface{}{
+		"this": data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return copyMap(data), nil
+	}
+	result, err := applyPatch(data, out, options.strategy)
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to apply trigger (%s)", t.expression)
+	}
+	return result, nil
+}
+
+// applyPatch applies the raw output of a trigger to a copy of the Mapper
+func applyPatch(data map[string]interface{}, out ref.Val, strategy MergeStrategy) (map[string]interface{}, error) {
+	patch := nativeValue(out)
+	if strategy == MergeJSONPatch {
+		ops, ok := patch.([]interface{})
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPatch, "expected a list of json patch operations, got %T", patch)
+		}
+		return jsonPatch(data, ops)
+	}
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidPatch, "expected a map, got %T", patch)
+	}
+	switch strategy {
+	case MergeShallow:
+		result := copyMap(data)
+		for k, v := range fields {
+			result[k] = v
+		}
+		return result, nil
+	case MergeDeep:
+		return deepMerge(data, fields), nil
+	case MergeJSONMergePatch:
+		return mergePatch(data, fields).(map[string]interface{}), nil
+	}
+	return nil, errors.Errorf("trigger: unknown merge strategy %v", strategy)
+}
+
+// nativeValue recursively converts a CEL value into maps, lists & primitive Go values. null is converted to nil.
+func nativeValue(val ref.Val) interface{} {
+	switch v := val.(type) {
+	case types.Null:
+		return nil
+	case traits.Mapper:
+		m := map[string]interface{}{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			key := it.Next()
+			m[fmt.Sprint(key.Value())] = nativeValue(v.Get(key))
+		}
+		return m
+	case traits.Lister:
+		var list []interface{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			list = append(list, nativeValue(it.Next()))
+		}
+		if list == nil {
+			list = []interface{}{}
+		}
+		return list
+	}
+	return val.Value()
+}
+
+func copyMap(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		result[k] = v
+	}
+	return result
+}
+
+// deepMerge returns a copy of data with the fields of patch merged into it recursively
+func deepMerge(data, patch map[string]interface{}) map[string]interface{} {
+	result := copyMap(data)
+	for k, v := range patch {
+		existing, isMap := result[k].(map[string]interface{})
+		nested, nestedIsMap := v.(map[string]interface{})
+		if isMap && nestedIsMap {
+			result[k] = deepMerge(existing, nested)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
+
+// mergePatch implements the MergePatch function of RFC 7386 without modifying target
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	fields, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+	existing, ok := target.(map[string]interface{})
+	if !ok {
+		existing = map[string]interface{}{}
+	}
+	result := copyMap(existing)
+	for k, v := range fields {
+		if v == nil {
+			delete(result, k)
+			continue
+		}
+		result[k] = mergePatch(result[k], v)
+	}
+	return result
+}
+
+// jsonPatch applies RFC 6902 operations to a copy of data
+func jsonPatch(data map[string]interface{}, ops []interface{}) (map[string]interface{}, error) {
+	var doc interface{} = deepCopy(data)
+	for i, o := range ops {
+		op, ok := o.(map[string]interface{})
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: expected a map, got %T", i, o)
+		}
+		name, _ := op["op"].(string)
+		path, ok := op["path"].(string)
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: missing path", i)
+		}
+		var err error
+		switch name {
+		case "add", "replace", "test":
+			value, ok := op["value"]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: missing value", i)
+			}
+			switch name {
+			case "add":
+				doc, err = pointerAdd(doc, path, deepCopy(value))
+			case "replace":
+				if doc, err = pointerRemove(doc, path); err == nil {
+					doc, err = pointerAdd(doc, path, deepCopy(value))
+				}
+			default:
+				var current interface{}
+				if current, err = pointerGet(doc, path); err == nil && !jsonEqual(current, value) {
+					err = errors.Wrapf(ErrPatchTestFailed, "path %s", path)
+				}
+			}
+		case "remove":
+			doc, err = pointerRemove(doc, path)
+		case "move", "copy":
+			from, ok := op["from"].(string)
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: missing from", i)
+			}
+			if name == "move" && strings.HasPrefix(path, from+"/") {
+				return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: cannot move %s into itself", i, from)
+			}
+			var value interface{}
+			if value, err = pointerGet(doc, from); err != nil {
+				break
+			}
+			if name == "move" {
+				if doc, err = pointerRemove(doc, from); err != nil {
+					break
+				}
+			} else {
+				value = deepCopy(value)
+			}
+			doc, err = pointerAdd(doc, path, value)
+		default:
+			return nil, errors.Wrapf(ErrInvalidPatch, "operation %v: unknown op %q", i, name)
+		}
+		if err != nil {
+			return nil, errors.Wrapf(err, "operation %v (%s %s)", i, name, path)
+		}
+	}
+	result, ok := doc.(map[string]interface{})
+	if !ok {
+		return nil, errors.Wrapf(ErrInvalidPatch, "expected the patched document to be a map, got %T", doc)
+	}
+	return result, nil
+}
+
+// deepCopy copies nested maps & lists. Slices of any type are copied as []interface{}.
+func deepCopy(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(v))
+		for k, val := range v {
+			result[k] = deepCopy(val)
+		}
+		return result
+	case []interface{}:
+		result := make([]interface{}, len(v))
+		for i, val := range v {
+			result[i] = deepCopy(val)
+		}
+		return result
+	case []byte:
+		return v
+	}
+	if rv := reflect.ValueOf(value); rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		result := make([]interface{}, rv.Len())
+		for i := range result {
+			result[i] = deepCopy(rv.Index(i).Interface())
+		}
+		return result
+	}
+	return value
+}
+
+// parsePointer splits an RFC 6901 JSON Pointer into it's unescaped reference tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, errors.Wrapf(ErrInvalidPatch, "invalid json pointer %q", pointer)
+	}
+	tokens := strings.Split(pointer[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(token)
+	}
+	return tokens, nil
+}
+
+func pointerGet(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range tokens {
+		switch v := doc.(type) {
+		case map[string]interface{}:
+			val, ok := v[token]
+			if !ok {
+				return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+			}
+			doc = val
+		case []interface{}:
+			index, err := listIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			doc = v[index]
+		default:
+			return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+		}
+	}
+	return doc, nil
+}
+
+// pointerAdd adds value at pointer & returns the resulting document
+func pointerAdd(doc interface{}, pointer string, value interface{}) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return value, nil
+	}
+	return update(doc, tokens, pointer, func(parent interface{}, token string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			v[token] = value
+			return v, nil
+		case []interface{}:
+			index := len(v)
+			if token != "-" {
+				if index, err = listIndex(token, len(v), true); err != nil {
+					return nil, err
+				}
+			}
+			v = append(v, nil)
+			copy(v[index+1:], v[index:])
+			v[index] = value
+			return v, nil
+		}
+		return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+	})
+}
+
+// pointerRemove removes the value at pointer & returns the resulting document
+func pointerRemove(doc interface{}, pointer string) (interface{}, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.Wrap(ErrInvalidPatch, "cannot remove the root document")
+	}
+	return update(doc, tokens, pointer, func(parent interface{}, token string) (interface{}, error) {
+		switch v := parent.(type) {
+		case map[string]interface{}:
+			if _, ok := v[token]; !ok {
+				return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+			}
+			delete(v, token)
+			return v, nil
+		case []interface{}:
+			index, err := listIndex(token, len(v), false)
+			if err != nil {
+				return nil, err
+			}
+			return append(v[:index], v[index+1:]...), nil
+		}
+		return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+	})
+}
+
+// update walks to the parent of the last token, replaces it with the result of fn & returns the resulting document
+func update(doc interface{}, tokens []string, pointer string, fn func(parent interface{}, token string) (interface{}, error)) (interface{}, error) {
+	if len(tokens) == 1 {
+		return fn(doc, tokens[0])
+	}
+	switch v := doc.(type) {
+	case map[string]interface{}:
+		child, ok := v[tokens[0]]
+		if !ok {
+			return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+		}
+		updated, err := update(child, tokens[1:], pointer, fn)
+		if err != nil {
+			return nil, err
+		}
+		v[tokens[0]] = updated
+		return v, nil
+	case []interface{}:
+		index, err := listIndex(tokens[0], len(v), false)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := update(v[index], tokens[1:], pointer, fn)
+		if err != nil {
+			return nil, err
+		}
+		v[index] = updated
+		return v, nil
+	}
+	return nil, errors.Wrapf(ErrInvalidPatch, "path %s does not exist", pointer)
+}
+
+// listIndex parses a list index token. If insert is true, the length of the list is a valid index.
+func listIndex(token string, length int, insert bool) (int, error) {
+	index, err := strconv.Atoi(token)
+	if err != nil || index < 0 || (token != "0" && strings.HasPrefix(token, "0")) {
+		return 0, errors.Wrapf(ErrInvalidPatch, "invalid list index %q", token)
+	}
+	if index > length || (!insert && index == length) {
+		return 0, errors.Wrapf(ErrInvalidPatch, "list index %v out of range", index)
+	}
+	return index, nil
+}
+
+// jsonEqual compares values by their json encoding so numbers of different types compare equal
+func jsonEqual(a, b interface{}) bool {
+	aJSON, aErr := json.Marshal(a)
+	bJSON, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && string(aJSON) == string(bJSON)
+}
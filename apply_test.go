@@ -0,0 +1,117 @@
+package trigger_test
+
+import (
+	"errors"
+	"github.com/graphikDB/trigger"
+	"reflect"
+	"testing"
+)
+
+func TestTrigger_Apply(t *testing.T) {
+	data := func() map[string]interface{} {
+		return map[string]interface{}{
+			"name":     "coleman",
+			"password": "123456",
+			"address": map[string]interface{}{
+				"city":  "denver",
+				"state": "co",
+			},
+			"tags": []interface{}{"a", "b"},
+		}
+	}
+	tests := []struct {
+		name     string
+		strategy trigger.MergeStrategy
+		mutation string
+		want     map[string]interface{}
+	}{
+		{
+			name:     "shallow",
+			strategy: trigger.MergeShallow,
+			mutation: "{'address': {'city': 'boulder'}}",
+			want: map[string]interface{}{
+				"name":     "coleman",
+				"password": "123456",
+				"address":  map[string]interface{}{"city": "boulder"},
+				"tags":     []interface{}{"a", "b"},
+			},
+		},
+		{
+			name:     "deep",
+			strategy: trigger.MergeDeep,
+			mutation: "{'address': {'city': 'boulder'}}",
+			want: map[string]interface{}{
+				"name":     "coleman",
+				"password": "123456",
+				"address":  map[string]interface{}{"city": "boulder", "state": "co"},
+				"tags":     []interface{}{"a", "b"},
+			},
+		},
+		{
+			name:     "json merge patch",
+			strategy: trigger.MergeJSONMergePatch,
+			mutation: "{'password': null, 'address': {'state': null, 'zip': '80301'}}",
+			want: map[string]interface{}{
+				"name":    "coleman",
+				"address": map[string]interface{}{"city": "denver", "zip": "80301"},
+				"tags":    []interface{}{"a", "b"},
+			},
+		},
+		{
+			name:     "json patch",
+			strategy: trigger.MergeJSONPatch,
+			mutation: `[
+				{'op': 'test', 'path': '/name', 'value': 'coleman'},
+				{'op': 'remove', 'path': '/password'},
+				{'op': 'add', 'path': '/tags/-', 'value': 'c'},
+				{'op': 'replace', 'path': '/tags/0', 'value': 'z'},
+				{'op': 'move', 'from': '/address/city', 'path': '/city'},
+				{'op': 'copy', 'from': '/name', 'path': '/address/name'}
+			]`,
+			want: map[string]interface{}{
+				"name":    "coleman",
+				"city":    "denver",
+				"address": map[string]interface{}{"state": "co", "name": "coleman"},
+				"tags":    []interface{}{"z", "b", "c"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := trigger.NewDecision("this.name == 'coleman'")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			tr, err := trigger.NewTrigger(decision, tt.mutation)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			input := data()
+			got, err := tr.Apply(input, trigger.WithMergeStrategy(tt.strategy))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %v, got: %v", tt.want, got)
+			}
+			if !reflect.DeepEqual(input, data()) {
+				t.Fatalf("expected input to be unmodified, got: %v", input)
+			}
+		})
+	}
+}
+
+func TestTrigger_Apply_JSONPatchTestFailed(t *testing.T) {
+	decision, err := trigger.NewDecision("true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tr, err := trigger.NewTrigger(decision, "[{'op': 'test', 'path': '/name', 'value': 'bob'}]")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = tr.Apply(map[string]interface{}{"name": "coleman"}, trigger.WithMergeStrategy(trigger.MergeJSONPatch))
+	if !errors.Is(err, trigger.ErrPatchTestFailed) {
+		t.Fatalf("expected test failure, got: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+package trigger
+
+import (
+	"fmt"
+	"github.com/pkg/errors"
+	"strings"
+	"unicode"
+)
+
+// ArrowError is returned when an arrow expression can't be split into it's decision & mutation or either half fails
+// to compile. Issue positions are relative to the whole arrow expression.
+type ArrowError struct {
+	// Expression is the arrow expression
+	Expression string
+	// Part is "decision" or "mutation" if a half failed to compile & empty if the arrow syntax is invalid
+	Part string
+	// Issues holds the problems found along with their positions
+	Issues []Issue
+	err    error
+}
+
+// Error returns each issue as line:column: message
+func (e *ArrowError) Error() string {
+	var issues []string
+	for _, issue := range e.Issues {
+		issues = append(issues, fmt.Sprintf("%v:%v: %s", issue.Line, issue.Column, issue.Message))
+	}
+	if len(issues) == 0 {
+		return e.err.Error()
+	}
+	if e.Part != "" {
+		return fmt.Sprintf("arrow operator: %s: %s", e.Part, strings.Join(issues, "; "))
+	}
+	return fmt.Sprintf("%s: %s", e.err.Error(), strings.Join(issues, "; "))
+}
+
+// Cause returns ErrArrowOperator if the arrow syntax is invalid or the underlying compile error
+func (e *ArrowError) Cause() error {
+	return e.err
+}
+
+// Unwrap returns ErrArrowOperator if the arrow syntax is invalid or the underlying compile error
+func (e *ArrowError) Unwrap() error {
+	return e.err
+}
+
+// arrowSplit is an arrow expression split into it's trimmed decision & mutation along with their starting positions
+type arrowSplit struct {
+	decision, mutation ruleField
+}
+
+// splitArrow finds the single arrow operator of the expression that isn't within a string literal or a comment
+func splitArrow(expression string) (*arrowSplit, error) {
+	source := []rune(expression)
+	var arrows []int
+	for i := 0; i < len(source); i++ {
+		switch r := source[i]; {
+		case r == '/' && i+1 < len(source) && source[i+1] == '/':
+			for i < len(source) && source[i] != '\n' {
+				i++
+			}
+		case r == '\'' || r == '"':
+			end := skipString(source, i)
+			if end < 0 {
+				line, column := runePosition(source, i)
+				return nil, &ArrowError{
+					Expression: expression,
+					Issues:     []Issue{{Line: line, Column: column, Message: "unterminated string literal"}},
+					err:        ErrArrowOperator,
+				}
+			}
+			i = end - 1
+		case r == '=' && i+1 < len(source) && source[i+1] == '>':
+			arrows = append(arrows, i)
+			i++
+		}
+	}
+	if len(arrows) != 1 {
+		e := &ArrowError{
+			Expression: expression,
+			err:        ErrArrowOperator,
+		}
+		for _, arrow := range arrows {
+			line, column := runePosition(source, arrow)
+			e.Issues = append(e.Issues, Issue{Line: line, Column: column, Message: fmt.Sprintf("unexpected %s", ArrowOperator)})
+		}
+		if len(arrows) > 1 {
+			// the first arrow is expected
+			e.Issues = e.Issues[1:]
+		}
+		return nil, e
+	}
+	return &arrowSplit{
+		decision: trimmedField(source, 0, arrows[0]),
+		mutation: trimmedField(source, arrows[0]+len(ArrowOperator), len(source)),
+	}, nil
+}
+
+// skipString returns the offset after the string literal starting at start, or -1 if the literal is unterminated.
+// Triple quoted & raw string literals are supported.
+func skipString(source []rune, start int) int {
+	quote := source[start]
+	raw := start > 0 && (source[start-1] == 'r' || source[start-1] == 'R') && (start < 2 || !isIdentRune(source[start-2]))
+	delimiter := []rune{quote}
+	if start+2 < len(source) && source[start+1] == quote && source[start+2] == quote {
+		delimiter = []rune{quote, quote, quote}
+	}
+	for i := start + len(delimiter); i < len(source); i++ {
+		if source[i] == '\\' && !raw {
+			i++
+			continue
+		}
+		if len(delimiter) == 1 && source[i] == '\n' {
+			return -1
+		}
+		if hasRunes(source[i:], delimiter) {
+			return i + len(delimiter)
+		}
+	}
+	return -1
+}
+
+func hasRunes(source []rune, prefix []rune) bool {
+	if len(source) < len(prefix) {
+		return false
+	}
+	for i, r := range prefix {
+		if source[i] != r {
+			return false
+		}
+	}
+	return true
+}
+
+func isIdentRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_'
+}
+
+// trimmedField returns the text between start & end without surrounding whitespace & the position it starts at
+func trimmedField(source []rune, start, end int) ruleField {
+	for start < end && unicode.IsSpace(source[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(source[end-1]) {
+		end--
+	}
+	line, column := runePosition(source, start)
+	return ruleField{
+		value:  string(source[start:end]),
+		line:   line,
+		column: column,
+	}
+}
+
+// runePosition returns the 1-based line & column of the rune offset
+func runePosition(source []rune, offset int) (int, int) {
+	line, column := 1, 1
+	for _, r := range source[:offset] {
+		if r == '\n' {
+			line++
+			column = 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
+
+// arrowError converts an error from compiling a half of an arrow expression into an *ArrowError
+func arrowError(expression, part string, field ruleField, err error) error {
+	compileErr, ok := errors.Cause(err).(*CompileError)
+	if !ok {
+		return errors.Wrapf(err, "failed to create trigger from arrow expression (%s)", part)
+	}
+	e := &ArrowError{
+		Expression: expression,
+		Part:       part,
+		err:        compileErr,
+	}
+	for _, issue := range compileErr.Issues {
+		line, column := field.position(issue.Line, issue.Column)
+		e.Issues = append(e.Issues, Issue{Line: line, Column: column, Message: issue.Message})
+	}
+	return e
+}
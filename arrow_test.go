@@ -0,0 +1,98 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewArrowTrigger_Parser(t *testing.T) {
+	tr, err := trigger.NewArrowTrigger(`
+	// notify when the note contains an arrow => or a "quote"
+	this.note == 'a=>b' || this.note == "c=>\"d" =>
+	{'arrow': '=>'} // trailing => comment`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if tr.DecisionSource() != `// notify when the note contains an arrow => or a "quote"
+	this.note == 'a=>b' || this.note == "c=>\"d"` {
+		t.Fatalf("unexpected decision source: %q", tr.DecisionSource())
+	}
+	if tr.MutationSource() != "{'arrow': '=>'} // trailing => comment" {
+		t.Fatalf("unexpected mutation source: %q", tr.MutationSource())
+	}
+	patch, err := tr.Trigger(map[string]interface{}{
+		"note": "a=>b",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !reflect.DeepEqual(patch, map[string]interface{}{"arrow": "=>"}) {
+		t.Fatalf("unexpected patch: %v", patch)
+	}
+}
+
+func TestNewArrowTrigger_Errors(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		part       string
+		want       []trigger.Issue
+		syntax     bool
+	}{
+		{
+			name:       "missing arrow",
+			expression: "this.name == 'bob'",
+			syntax:     true,
+		},
+		{
+			name:       "multiple arrows",
+			expression: "true => {'a': 1} => {'b': 2}",
+			want:       []trigger.Issue{{Line: 1, Column: 18}},
+			syntax:     true,
+		},
+		{
+			name:       "unterminated string",
+			expression: "this.name == 'bob => {'a': 1}",
+			want:       []trigger.Issue{{Line: 1, Column: 25}},
+			syntax:     true,
+		},
+		{
+			name:       "decision",
+			expression: "this.name ==\n  => {'a': 1}",
+			part:       "decision",
+			want:       []trigger.Issue{{Line: 1, Column: 13}},
+		},
+		{
+			name:       "mutation",
+			expression: "this.name == 'bob' =>\n  {'a': undefined_var}",
+			part:       "mutation",
+			want:       []trigger.Issue{{Line: 2, Column: 9}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := trigger.NewArrowTrigger(tt.expression)
+			arrowErr, ok := err.(*trigger.ArrowError)
+			if !ok {
+				t.Fatalf("expected an arrow error, got: %v", err)
+			}
+			if tt.syntax != (errors.Cause(err) == trigger.ErrArrowOperator) {
+				t.Fatalf("unexpected cause: %v", errors.Cause(err))
+			}
+			if arrowErr.Part != tt.part {
+				t.Fatalf("expected part %q, got: %q", tt.part, arrowErr.Part)
+			}
+			if len(arrowErr.Issues) != len(tt.want) {
+				t.Fatalf("expected %v issues, got: %v", len(tt.want), err.Error())
+			}
+			for i, want := range tt.want {
+				got := arrowErr.Issues[i]
+				if got.Line != want.Line || got.Column != want.Column {
+					t.Fatalf("expected issue at %v:%v, got: %v", want.Line, want.Column, err.Error())
+				}
+			}
+		})
+	}
+}
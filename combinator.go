@@ -0,0 +1,203 @@
+package trigger
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Evaluator evaluates a decision against a Mapper. It returns ErrDecisionDenied if the decision evaluates to false.
+// Decision & the decision combinators implement Evaluator.
+type Evaluator interface {
+	Eval(data map[string]interface{}) error
+}
+
+// Verdict is the outcome of a decision combinator along with the member that determined it
+type Verdict struct {
+	// Allowed is true if the combinator allowed
+	Allowed bool
+	// Member is the index of the member that determined the outcome or -1 if the outcome was the combinator's default
+	Member int
+	// Decision is the member that determined the outcome or nil if the outcome was the combinator's default
+	Decision Evaluator
+}
+
+type combinatorKind int
+
+const (
+	allOf combinatorKind = iota
+	anyOf
+	noneOf
+	firstApplicable
+	weightedVote
+)
+
+// Combinator composes multiple decisions into a single decision. Members are evaluated in order & evaluation stops as
+// soon as the outcome is known. Evaluation errors are returned immediately.
+type Combinator struct {
+	kind      combinatorKind
+	members   []Evaluator
+	targets   []Evaluator
+	weights   []float64
+	threshold float64
+}
+
+// AllOf allows if every member decision allows. It stops at the first denial.
+func AllOf(decisions ...Evaluator) *Combinator {
+	return &Combinator{
+		kind:    allOf,
+		members: decisions,
+	}
+}
+
+// AnyOf allows if any member decision allows. It stops at the first allowance.
+func AnyOf(decisions ...Evaluator) *Combinator {
+	return &Combinator{
+		kind:    anyOf,
+		members: decisions,
+	}
+}
+
+// NoneOf allows if every member decision denies. It stops at the first allowance.
+func NoneOf(decisions ...Evaluator) *Combinator {
+	return &Combinator{
+		kind:    noneOf,
+		members: decisions,
+	}
+}
+
+// Case is a member of FirstApplicable. The Decision of the Case applies if it's Target allows.
+type Case struct {
+	Target   Evaluator
+	Decision Evaluator
+}
+
+// FirstApplicable evaluates the Decision of the first Case whose Target allows. It denies if no Case applies.
+func FirstApplicable(cases ...Case) *Combinator {
+	c := &Combinator{
+		kind: firstApplicable,
+	}
+	for _, cs := range cases {
+		c.targets = append(c.targets, cs.Target)
+		c.members = append(c.members, cs.Decision)
+	}
+	return c
+}
+
+// Vote is a weighted member of WeightedVote
+type Vote struct {
+	Decision Evaluator
+	Weight   float64
+}
+
+// WeightedVote allows if the total weight of the allowing members divided by the total weight of all members is at
+// least threshold, ex: a threshold of 0.5 is a weighted majority.
+func WeightedVote(threshold float64, votes ...Vote) *Combinator {
+	c := &Combinator{
+		kind:      weightedVote,
+		threshold: threshold,
+	}
+	for _, v := range votes {
+		c.members = append(c.members, v.Decision)
+		c.weights = append(c.weights, v.Weight)
+	}
+	return c
+}
+
+// Eval evaluates the combinator against the Mapper. It returns ErrDecisionDenied if the combinator denies.
+func (c *Combinator) Eval(data map[string]interface{}) error {
+	verdict, err := c.Decide(data)
+	if err != nil {
+		return err
+	}
+	if !verdict.Allowed {
+		return ErrDecisionDenied
+	}
+	return nil
+}
+
+// Decide evaluates the combinator against the Mapper & reports which member determined the outcome
+func (c *Combinator) Decide(data map[string]interface{}) (*Verdict, error) {
+	switch c.kind {
+	case allOf, anyOf, noneOf:
+		for i, member := range c.members {
+			allowed, err := evaluate(member, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: failed to evaluate member %v", i)
+			}
+			switch {
+			case c.kind == allOf && !allowed:
+				return c.verdict(false, i), nil
+			case c.kind == anyOf && allowed:
+				return c.verdict(true, i), nil
+			case c.kind == noneOf && allowed:
+				return c.verdict(false, i), nil
+			}
+		}
+		return c.verdict(c.kind != anyOf, -1), nil
+	case firstApplicable:
+		for i, target := range c.targets {
+			applies := true
+			if target != nil {
+				var err error
+				if applies, err = evaluate(target, data); err != nil {
+					return nil, errors.Wrapf(err, "trigger: failed to evaluate target %v", i)
+				}
+			}
+			if !applies {
+				continue
+			}
+			allowed, err := evaluate(c.members[i], data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: failed to evaluate member %v", i)
+			}
+			return c.verdict(allowed, i), nil
+		}
+		return c.verdict(false, -1), nil
+	case weightedVote:
+		var total float64
+		for _, w := range c.weights {
+			total += w
+		}
+		var allowedWeight, remaining = 0.0, total
+		for i, member := range c.members {
+			allowed, err := evaluate(member, data)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: failed to evaluate member %v", i)
+			}
+			remaining -= c.weights[i]
+			if allowed {
+				allowedWeight += c.weights[i]
+			}
+			if total > 0 && allowedWeight/total >= c.threshold {
+				return c.verdict(true, i), nil
+			}
+			if total > 0 && (allowedWeight+remaining)/total < c.threshold {
+				return c.verdict(false, i), nil
+			}
+		}
+		return c.verdict(total > 0 && allowedWeight/total >= c.threshold, -1), nil
+	}
+	return nil, errors.New("trigger: unknown combinator")
+}
+
+func (c *Combinator) verdict(allowed bool, member int) *Verdict {
+	v := &Verdict{
+		Allowed: allowed,
+		Member:  member,
+	}
+	if member >= 0 {
+		v.Decision = c.members[member]
+	}
+	return v
+}
+
+// evaluate returns true if the evaluator allows & false if it denies
+func evaluate(e Evaluator, data map[string]interface{}) (bool, error) {
+	err := e.Eval(data)
+	if errors.Cause(err) == ErrDecisionDenied {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,92 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"testing"
+)
+
+func TestCombinator(t *testing.T) {
+	mustDecision := func(expression string) *trigger.Decision {
+		decision, err := trigger.NewDecision(expression)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return decision
+	}
+	isAdmin := mustDecision("this.role == 'admin'")
+	isAcme := mustDecision("this.org == 'acme'")
+	isBanned := mustDecision("this.banned == true")
+	user := map[string]interface{}{
+		"role":   "viewer",
+		"org":    "acme",
+		"banned": false,
+	}
+	tests := []struct {
+		name       string
+		combinator *trigger.Combinator
+		allowed    bool
+		member     int
+	}{
+		{
+			name:       "all of",
+			combinator: trigger.AllOf(isAcme, isAdmin, isBanned),
+			allowed:    false,
+			member:     1,
+		},
+		{
+			name:       "any of",
+			combinator: trigger.AnyOf(isAdmin, isAcme, isBanned),
+			allowed:    true,
+			member:     1,
+		},
+		{
+			name:       "none of",
+			combinator: trigger.NoneOf(isAdmin, isBanned),
+			allowed:    true,
+			member:     -1,
+		},
+		{
+			name: "first applicable",
+			combinator: trigger.FirstApplicable(
+				trigger.Case{Target: isBanned, Decision: mustDecision("false")},
+				trigger.Case{Target: isAcme, Decision: trigger.AnyOf(isAdmin, mustDecision("this.role == 'viewer'"))},
+			),
+			allowed: true,
+			member:  1,
+		},
+		{
+			name: "weighted vote",
+			combinator: trigger.WeightedVote(0.5,
+				trigger.Vote{Decision: isAdmin, Weight: 3},
+				trigger.Vote{Decision: isAcme, Weight: 1},
+				trigger.Vote{Decision: isBanned, Weight: 1},
+			),
+			allowed: false,
+			member:  0,
+		},
+		{
+			name:       "nested",
+			combinator: trigger.AllOf(isAcme, trigger.NoneOf(isBanned)),
+			allowed:    true,
+			member:     -1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			verdict, err := tt.combinator.Decide(user)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if verdict.Allowed != tt.allowed || verdict.Member != tt.member {
+				t.Fatalf("Decide() = %v/%v, want %v/%v", verdict.Allowed, verdict.Member, tt.allowed, tt.member)
+			}
+			err = tt.combinator.Eval(user)
+			if tt.allowed && err != nil {
+				t.Fatal(err.Error())
+			}
+			if !tt.allowed && err != trigger.ErrDecisionDenied {
+				t.Fatalf("expected decision to be denied, got %v", err)
+			}
+		})
+	}
+}
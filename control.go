@@ -0,0 +1,242 @@
+package trigger
+
+import (
+	"context"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/google/cel-go/interpreter"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"math"
+)
+
+var ErrCostLimitExceeded = errors.New("trigger: cost limit exceeded")
+
+// Limits bounds the cost of evaluating an expression. Zero values are unlimited.
+type Limits struct {
+	// MaxCost is the maximum number of function calls, comprehension steps & literals evaluated
+	MaxCost int64
+	// MaxIterations is the maximum number of comprehension iterations (exists, all, map, filter)
+	MaxIterations int64
+	// MaxStringLength is the maximum length of any string produced during evaluation
+	MaxStringLength int
+	// MaxOutputSize is the maximum number of fields in a trigger's output
+	MaxOutputSize int
+}
+
+// merge returns the limits with the non-zero fields of other taking precedence
+func (l Limits) merge(other Limits) Limits {
+	if other.MaxCost != 0 {
+		l.MaxCost = other.MaxCost
+	}
+	if other.MaxIterations != 0 {
+		l.MaxIterations = other.MaxIterations
+	}
+	if other.MaxStringLength != 0 {
+		l.MaxStringLength = other.MaxStringLength
+	}
+	if other.MaxOutputSize != 0 {
+		l.MaxOutputSize = other.MaxOutputSize
+	}
+	return l
+}
+
+// WithLimits sets the default Limits of every evaluation within the Env
+func WithLimits(limits Limits) EnvOption {
+	return func(o *envOptions) {
+		o.limits = limits
+	}
+}
+
+type limitsCtxKey struct{}
+
+// ContextWithLimits returns a context that overrides the Env's Limits when passed to EvalContext or TriggerContext
+func ContextWithLimits(ctx context.Context, limits Limits) context.Context {
+	return context.WithValue(ctx, limitsCtxKey{}, limits)
+}
+
+func limitsFromContext(ctx context.Context) Limits {
+	if limits, ok := ctx.Value(limitsCtxKey{}).(Limits); ok {
+		return limits
+	}
+	return Limits{}
+}
+
+// controlVar is the activation variable that holds the evaluation's control. It is not a valid CEL identifier so it
+// cannot collide with user declared variables.
+const controlVar = "#control"
+
+// control is passed to programs through the activation & is checked as each expression node is evaluated
+type control struct {
+	ctx        context.Context
+	limits     Limits
+	cost       int64
+	iterations int64
+	exceeded   error
+}
+
+func newControl(ctx context.Context, limits Limits) *control {
+	limits = limits.merge(limitsFromContext(ctx))
+	if ctx.Done() == nil && limits == (Limits{}) {
+		return nil
+	}
+	return &control{
+		ctx:    ctx,
+		limits: limits,
+	}
+}
+
+// before is called before an expression node is evaluated & returns an error value if evaluation should be stopped
+func (c *control) before(loopStep bool) ref.Val {
+	if c.exceeded != nil {
+		return types.NewErr(c.exceeded.Error())
+	}
+	select {
+	case <-c.ctx.Done():
+		return types.NewErr(c.ctx.Err().Error())
+	default:
+	}
+	c.cost++
+	if c.limits.MaxCost > 0 && c.cost > c.limits.MaxCost {
+		return c.exceed("max cost = %v", c.limits.MaxCost)
+	}
+	if loopStep {
+		c.iterations++
+		if c.limits.MaxIterations > 0 && c.iterations > c.limits.MaxIterations {
+			return c.exceed("max iterations = %v", c.limits.MaxIterations)
+		}
+	}
+	return nil
+}
+
+// after is called with the result of an expression node & returns an error value if the result exceeds the limits
+func (c *control) after(val ref.Val) ref.Val {
+	if str, ok := val.(types.String); ok && c.limits.MaxStringLength > 0 && len(str) > c.limits.MaxStringLength {
+		return c.exceed("max string length = %v", c.limits.MaxStringLength)
+	}
+	return val
+}
+
+func (c *control) exceed(format string, args ...interface{}) ref.Val {
+	c.exceeded = errors.Wrapf(ErrCostLimitExceeded, format, args...)
+	return types.NewErr(c.exceeded.Error())
+}
+
+// checkOutput returns an error if the trigger output exceeds the limits
+func (c *control) checkOutput(out ref.Val) error {
+	if c == nil || c.limits.MaxOutputSize <= 0 {
+		return nil
+	}
+	if sizer, ok := out.(traits.Sizer); ok && sizer.Size().(types.Int) > types.Int(c.limits.MaxOutputSize) {
+		return errors.Wrapf(ErrCostLimitExceeded, "max output size = %v", c.limits.MaxOutputSize)
+	}
+	return nil
+}
+
+// err returns the reason evaluation was stopped, if any
+func (c *control) err() error {
+	if c == nil {
+		return nil
+	}
+	if c.exceeded != nil {
+		return c.exceeded
+	}
+	return c.ctx.Err()
+}
+
+// activation adds the control to the input variables
+func (c *control) activation(vars map[string]interface{}) map[string]interface{} {
+	if c == nil {
+		return vars
+	}
+	activation := make(map[string]interface{}, len(vars)+1)
+	for k, v := range vars {
+		activation[k] = v
+	}
+	activation[controlVar] = c
+	return activation
+}
+
+// newControlDecorator wraps calls, comprehensions & literals so evaluation stops once the control says so.
+// Attributes & constants are left as-is since the planner inspects them when building their parents.
+func newControlDecorator(ast *expr.Expr) interpreter.InterpretableDecorator {
+	loopSteps := map[int64]bool{}
+	walkExpr(ast, func(e *expr.Expr) {
+		if c := e.GetComprehensionExpr(); c != nil {
+			loopSteps[c.GetLoopStep().GetId()] = true
+		}
+	})
+	return func(i interpreter.Interpretable) (interpreter.Interpretable, error) {
+		switch i.(type) {
+		case interpreter.InterpretableAttribute, interpreter.InterpretableConst:
+			return i, nil
+		default:
+			return &controlled{
+				Interpretable: i,
+				loopStep:      loopSteps[i.ID()],
+			}, nil
+		}
+	}
+}
+
+type controlled struct {
+	interpreter.Interpretable
+	loopStep bool
+}
+
+// Eval implements the interpreter.Interpretable interface
+func (c *controlled) Eval(activation interpreter.Activation) ref.Val {
+	val, ok := activation.ResolveName(controlVar)
+	if !ok {
+		return c.Interpretable.Eval(activation)
+	}
+	ctrl, ok := val.(*control)
+	if !ok {
+		return c.Interpretable.Eval(activation)
+	}
+	if err := ctrl.before(c.loopStep); err != nil {
+		return err
+	}
+	return ctrl.after(c.Interpretable.Eval(activation))
+}
+
+// walkExpr calls fn on the expression & all of it's sub-expressions
+func walkExpr(e *expr.Expr, fn func(e *expr.Expr)) {
+	if e == nil {
+		return
+	}
+	fn(e)
+	switch k := e.GetExprKind().(type) {
+	case *expr.Expr_SelectExpr:
+		walkExpr(k.SelectExpr.GetOperand(), fn)
+	case *expr.Expr_CallExpr:
+		walkExpr(k.CallExpr.GetTarget(), fn)
+		for _, arg := range k.CallExpr.GetArgs() {
+			walkExpr(arg, fn)
+		}
+	case *expr.Expr_ListExpr:
+		for _, elem := range k.ListExpr.GetElements() {
+			walkExpr(elem, fn)
+		}
+	case *expr.Expr_StructExpr:
+		for _, entry := range k.StructExpr.GetEntries() {
+			walkExpr(entry.GetMapKey(), fn)
+			walkExpr(entry.GetValue(), fn)
+		}
+	case *expr.Expr_ComprehensionExpr:
+		walkExpr(k.ComprehensionExpr.GetIterRange(), fn)
+		walkExpr(k.ComprehensionExpr.GetAccuInit(), fn)
+		walkExpr(k.ComprehensionExpr.GetLoopCondition(), fn)
+		walkExpr(k.ComprehensionExpr.GetLoopStep(), fn)
+		walkExpr(k.ComprehensionExpr.GetResult(), fn)
+	}
+}
+
+// Cost implements the interpreter.Coster interface so static cost estimation sees through the control
+func (c *controlled) Cost() (min, max int64) {
+	if coster, ok := c.Interpretable.(interpreter.Coster); ok {
+		return coster.Cost()
+	}
+	return 0, math.MaxInt64
+}
@@ -0,0 +1,76 @@
+package trigger
+
+import (
+	"github.com/google/cel-go/cel"
+	"github.com/pkg/errors"
+	"math"
+)
+
+// WithMaxEstimatedCost makes NewDecision & NewTrigger fail with ErrCostLimitExceeded if the estimated maximum cost of
+// the expression exceeds max. Expressions whose cost depends on the size of their input, ex: comprehensions over input
+// lists, have an unbounded maximum cost.
+func WithMaxEstimatedCost(max int64) EnvOption {
+	return func(o *envOptions) {
+		o.maxEstimatedCost = max
+	}
+}
+
+// EstimateCost returns the heuristic min/max cost of evaluating the decision computed from it's checked expression
+func (n *Decision) EstimateCost() (min, max int64) {
+	return estimateCost(n.program)
+}
+
+// EstimateCost returns the heuristic min/max cost of evaluating the trigger's decision & mutation. The minimum
+// cost is incurred when the decision denies. A trigger without a decision always evaluates it's mutation & a trigger
+// with an else mutation evaluates the costlier of it's mutations.
+func (t *Trigger) EstimateCost() (min, max int64) {
+	mMin, mMax := estimateCost(t.program)
+	if t.decision == nil {
+		return mMin, mMax
+	}
+	dMin, dMax := t.decision.EstimateCost()
+	if t.otherwise != nil {
+		eMin, eMax := t.otherwise.EstimateCost()
+		if mMin < eMin {
+			eMin = mMin
+		}
+		if mMax > eMax {
+			eMax = mMax
+		}
+		return addCost(dMin, eMin), addCost(dMax, eMax)
+	}
+	return dMin, addCost(dMax, mMax)
+}
+
+func (e *Env) checkCost(expression string, max int64) error {
+	if e.maxEstimatedCost > 0 && max > e.maxEstimatedCost {
+		return errors.Wrapf(ErrCostLimitExceeded, "estimated max cost of (%s) = %v exceeds %v", expression, costString(max), e.maxEstimatedCost)
+	}
+	return nil
+}
+
+func estimateCost(program cel.Program) (min, max int64) {
+	min, max = cel.EstimateCost(program)
+	// cel doesn't guard against overflow when summing unbounded costs
+	if min < 0 {
+		min = math.MaxInt64
+	}
+	if max < 0 {
+		max = math.MaxInt64
+	}
+	return min, max
+}
+
+func addCost(a, b int64) int64 {
+	if a > math.MaxInt64-b {
+		return math.MaxInt64
+	}
+	return a + b
+}
+
+func costString(cost int64) interface{} {
+	if cost == math.MaxInt64 {
+		return "unbounded"
+	}
+	return cost
+}
@@ -1,8 +1,10 @@
 package trigger
 
 import (
+	"context"
 	"github.com/google/cel-go/cel"
 	"github.com/pkg/errors"
+	"sync"
 )
 
 var (
@@ -12,30 +14,81 @@ var (
 
 // Decision is used to evaluate boolean expressions
 type Decision struct {
+	env        *Env
+	ast        *cel.Ast
 	program    cel.Program
 	expression string
+
+	explainOnce    sync.Once
+	explainProgram cel.Program
+	explainErr     error
+
+	partialOnce    sync.Once
+	partialProgram cel.Program
+	partialErr     error
 }
 
-// NewDecision creates a new Decision with the given boolean CEL expressions
+// NewDecision creates a new Decision with the given boolean CEL expressions using the default Env
 func NewDecision(expression string) (*Decision, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewDecision(expression)
+}
+
+// NewDecision creates a new Decision with the given boolean CEL expressions
+func (e *Env) NewDecision(expression string) (*Decision, error) {
 	if expression == "" {
 		return nil, ErrEmptyExpressions
 	}
-	program, err := globalEnv.Program(expression)
+	c, err := e.compile(expression)
 	if err != nil {
 		return nil, err
 	}
+	_, max := estimateCost(c.program)
+	if err := e.checkCost(expression, max); err != nil {
+		return nil, err
+	}
 	return &Decision{
-		program:    program,
+		env:        e,
+		ast:        c.ast,
+		program:    c.program,
 		expression: expression,
 	}, nil
 }
 
 // Eval evaluates the boolean CEL expressions against the Mapper
 func (n *Decision) Eval(data map[string]interface{}) error {
-	out, _, err := n.program.Eval(map[string]interface{}{
+	return n.EvalVars(map[string]interface{}{
+		"this": data,
+	})
+}
+
+// EvalContext is like Eval but evaluation is stopped once the context is done
+func (n *Decision) EvalContext(ctx context.Context, data map[string]interface{}) error {
+	return n.evalVars(ctx, map[string]interface{}{
 		"this": data,
 	})
+}
+
+// EvalVars evaluates the boolean CEL expressions against the named input variables declared in the Env
+func (n *Decision) EvalVars(vars map[string]interface{}) error {
+	return n.evalVars(context.Background(), vars)
+}
+
+func (n *Decision) evalVars(ctx context.Context, vars map[string]interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return errors.Wrapf(err, "trigger: failed to evaluate decision (%s)", n.expression)
+	}
+	vars, err := n.env.vars(vars)
+	if err != nil {
+		return err
+	}
+	ctrl := newControl(ctx, n.env.limits)
+	out, _, err := n.program.Eval(ctrl.activation(vars))
+	if ctrlErr := ctrl.err(); ctrlErr != nil {
+		return errors.Wrapf(ctrlErr, "trigger: failed to evaluate decision (%s)", n.expression)
+	}
 	if err != nil {
 		return errors.Wrapf(err, "trigger: failed to evaluate decision (%s)", n.expression)
 	}
@@ -0,0 +1,348 @@
+package trigger
+
+import (
+	"github.com/pkg/errors"
+	"strconv"
+	"unicode"
+)
+
+// ParseRules compiles rules written in the rule language using the default Env
+func ParseRules(src string) (*RuleSet, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.ParseRules(src)
+}
+
+// ParseRules compiles rules written in the rule language:
+//
+//	// comments start with two slashes
+//	let signup = this.event == 'signup'
+//	rule "welcome" priority 10 when signup && has(this.email) then {'welcome': true} else {'welcome': false}
+//
+// let bindings name an expression that may be referenced by the rules & bindings that follow it. priority & else are
+// optional. let, rule, priority, when, then & else are reserved words outside of expressions. All problems are
+// returned together as a *RuleSetError.
+func (e *Env) ParseRules(src string) (*RuleSet, error) {
+	return e.loadRuleSet([]byte(src), "", RuleFormatDSL)
+}
+
+// dslScanner reads the rule language
+type dslScanner struct {
+	src  []rune
+	pos  int
+	lets map[string]*dslExpr
+}
+
+// dslExpr is an expression with let bindings expanded. origin maps each rune of the expansion to it's source offset.
+type dslExpr struct {
+	runes  []rune
+	origin []int
+}
+
+// dslError is a problem found at a source offset
+type dslError struct {
+	offset int
+	err    error
+}
+
+func parseDSLRules(src []byte) ([]*ruleSpec, []*RuleError) {
+	s := &dslScanner{
+		src:  []rune(string(src)),
+		lets: map[string]*dslExpr{},
+	}
+	specs, err := s.parse()
+	if err != nil {
+		line, column := runePosition(s.src, err.offset)
+		return specs, []*RuleError{{Line: line, Column: column, Err: err.err}}
+	}
+	return specs, nil
+}
+
+func (s *dslScanner) errorf(offset int, format string, args ...interface{}) *dslError {
+	return &dslError{
+		offset: offset,
+		err:    errors.Errorf(format, args...),
+	}
+}
+
+func (s *dslScanner) parse() ([]*ruleSpec, *dslError) {
+	var specs []*ruleSpec
+	for {
+		s.skipSpace()
+		if s.pos >= len(s.src) {
+			return specs, nil
+		}
+		start := s.pos
+		switch word := s.word(); word {
+		case "let":
+			if err := s.let(); err != nil {
+				return specs, err
+			}
+		case "rule":
+			spec, err := s.rule(start)
+			if err != nil {
+				return specs, err
+			}
+			specs = append(specs, spec)
+		default:
+			return specs, s.errorf(start, "expected let or rule, got %q", word)
+		}
+	}
+}
+
+// let parses: let ${name} = ${expression}
+func (s *dslScanner) let() *dslError {
+	s.skipSpace()
+	start := s.pos
+	name := s.word()
+	if name == "" {
+		return s.errorf(start, "expected a let binding name")
+	}
+	if reserved[name] {
+		return s.errorf(start, "%s is a reserved word", name)
+	}
+	if _, ok := s.lets[name]; ok {
+		return s.errorf(start, "duplicate let binding %s", name)
+	}
+	s.skipSpace()
+	if s.pos >= len(s.src) || s.src[s.pos] != '=' {
+		return s.errorf(s.pos, "expected = after let %s", name)
+	}
+	s.pos++
+	exprStart, exprEnd, _ := s.expression()
+	if exprStart == exprEnd {
+		return s.errorf(exprStart, "expected an expression for let %s", name)
+	}
+	s.lets[name] = s.expand(exprStart, exprEnd)
+	return nil
+}
+
+// rule parses: rule "${name}" [priority ${n}] when ${decision} then ${mutation} [else ${mutation}]
+func (s *dslScanner) rule(start int) (*ruleSpec, *dslError) {
+	spec := &ruleSpec{
+		enabled: true,
+	}
+	spec.line, spec.column = runePosition(s.src, start)
+	s.skipSpace()
+	if s.pos >= len(s.src) || s.src[s.pos] != '"' {
+		return nil, s.errorf(s.pos, "expected a quoted rule name")
+	}
+	end := skipString(s.src, s.pos)
+	if end < 0 {
+		return nil, s.errorf(s.pos, "unterminated rule name")
+	}
+	name, err := strconv.Unquote(string(s.src[s.pos:end]))
+	if err != nil {
+		return nil, s.errorf(s.pos, "invalid rule name: %s", err)
+	}
+	spec.id = name
+	s.pos = end
+	s.skipSpace()
+	keyword := s.pos
+	word := s.word()
+	if word == "priority" {
+		s.skipSpace()
+		numStart := s.pos
+		if s.pos < len(s.src) && (s.src[s.pos] == '-' || s.src[s.pos] == '+') {
+			s.pos++
+		}
+		for s.pos < len(s.src) && unicode.IsDigit(s.src[s.pos]) {
+			s.pos++
+		}
+		priority, err := strconv.Atoi(string(s.src[numStart:s.pos]))
+		if err != nil {
+			return nil, s.errorf(numStart, "invalid priority for rule %s", name)
+		}
+		spec.priority = priority
+		s.skipSpace()
+		keyword = s.pos
+		word = s.word()
+	}
+	if word != "when" {
+		return nil, s.errorf(keyword, "expected when in rule %s", name)
+	}
+	exprStart, exprEnd, next := s.expression()
+	spec.decision = s.field(exprStart, exprEnd)
+	if next != "then" {
+		return nil, s.errorf(exprEnd, "expected then in rule %s", name)
+	}
+	s.pos += len("then")
+	exprStart, exprEnd, next = s.expression()
+	spec.mutation = s.field(exprStart, exprEnd)
+	if next == "else" {
+		s.pos += len("else")
+		exprStart, exprEnd, next = s.expression()
+		spec.otherwise = s.field(exprStart, exprEnd)
+		if spec.otherwise.value == "" {
+			return nil, s.errorf(exprStart, "expected an expression after else in rule %s", name)
+		}
+	}
+	if next != "" && next != "rule" && next != "let" {
+		return nil, s.errorf(s.pos, "unexpected %s in rule %s", next, name)
+	}
+	return spec, nil
+}
+
+// reserved words end an expression
+var reserved = map[string]bool{
+	"let":      true,
+	"rule":     true,
+	"priority": true,
+	"when":     true,
+	"then":     true,
+	"else":     true,
+}
+
+// expression reads an expression up to the next reserved word outside of brackets, strings & comments. It returns
+// the trimmed bounds of the expression & the reserved word that ended it, if any. The scanner is left at the word.
+func (s *dslScanner) expression() (int, int, string) {
+	start := s.pos
+	depth := 0
+	next := ""
+	for s.pos < len(s.src) && next == "" {
+		switch r := s.src[s.pos]; {
+		case r == '/' && s.pos+1 < len(s.src) && s.src[s.pos+1] == '/':
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		case r == '\'' || r == '"':
+			end := skipString(s.src, s.pos)
+			if end < 0 {
+				end = len(s.src)
+			}
+			s.pos = end
+		case r == '(' || r == '[' || r == '{':
+			depth++
+			s.pos++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+			s.pos++
+		case isIdentRune(r) && (s.pos == 0 || !isIdentRune(s.src[s.pos-1]) && s.src[s.pos-1] != '.'):
+			wordStart := s.pos
+			word := s.word()
+			if depth <= 0 && reserved[word] {
+				s.pos = wordStart
+				next = word
+			}
+		default:
+			s.pos++
+		}
+	}
+	end := s.pos
+	for start < end && unicode.IsSpace(s.src[start]) {
+		start++
+	}
+	for end > start && unicode.IsSpace(s.src[end-1]) {
+		end--
+	}
+	return start, end, next
+}
+
+// field expands the let bindings of the expression between start & end
+func (s *dslScanner) field(start, end int) ruleField {
+	expanded := s.expand(start, end)
+	f := ruleField{
+		value: string(expanded.runes),
+	}
+	if start == end {
+		return f
+	}
+	f.line, f.column = runePosition(s.src, start)
+	f.mapper = func(line, column int) (int, int) {
+		offset := 0
+		for l := 1; l < line && offset < len(expanded.runes); offset++ {
+			if expanded.runes[offset] == '\n' {
+				l++
+			}
+		}
+		offset += column - 1
+		switch {
+		case offset < 0:
+			offset = 0
+		case offset >= len(expanded.origin):
+			return runePosition(s.src, end)
+		}
+		return runePosition(s.src, expanded.origin[offset])
+	}
+	return f
+}
+
+// expand replaces references to let bindings with the parenthesized binding
+func (s *dslScanner) expand(start, end int) *dslExpr {
+	e := &dslExpr{}
+	add := func(r rune, origin int) {
+		e.runes = append(e.runes, r)
+		e.origin = append(e.origin, origin)
+	}
+	for i := start; i < end; i++ {
+		r := s.src[i]
+		switch {
+		case r == '/' && i+1 < end && s.src[i+1] == '/':
+			for ; i < end && s.src[i] != '\n'; i++ {
+				add(s.src[i], i)
+			}
+			i--
+		case r == '\'' || r == '"':
+			stringEnd := skipString(s.src, i)
+			if stringEnd < 0 || stringEnd > end {
+				stringEnd = end
+			}
+			for ; i < stringEnd; i++ {
+				add(s.src[i], i)
+			}
+			i--
+		case isIdentRune(r) && (i == start || !isIdentRune(s.src[i-1]) && s.src[i-1] != '.'):
+			wordEnd := i
+			for wordEnd < end && isIdentRune(s.src[wordEnd]) {
+				wordEnd++
+			}
+			binding, ok := s.lets[string(s.src[i:wordEnd])]
+			if !ok {
+				for ; i < wordEnd; i++ {
+					add(s.src[i], i)
+				}
+				i--
+				continue
+			}
+			add('(', i)
+			for j, br := range binding.runes {
+				// problems within the binding are reported at the binding's definition
+				add(br, binding.origin[j])
+			}
+			// a trailing comment in the binding must not swallow the closing parenthesis. problems at the closing
+			// parenthesis, ex: an incomplete binding, are reported at the end of the binding.
+			bindingEnd := binding.origin[len(binding.origin)-1] + 1
+			add('\n', bindingEnd)
+			add(')', bindingEnd)
+			i = wordEnd - 1
+		default:
+			add(r, i)
+		}
+	}
+	return e
+}
+
+func (s *dslScanner) skipSpace() {
+	for s.pos < len(s.src) {
+		switch {
+		case unicode.IsSpace(s.src[s.pos]):
+			s.pos++
+		case s.src[s.pos] == '/' && s.pos+1 < len(s.src) && s.src[s.pos+1] == '/':
+			for s.pos < len(s.src) && s.src[s.pos] != '\n' {
+				s.pos++
+			}
+		default:
+			return
+		}
+	}
+}
+
+// word reads an identifier
+func (s *dslScanner) word() string {
+	start := s.pos
+	for s.pos < len(s.src) && isIdentRune(s.src[s.pos]) {
+		s.pos++
+	}
+	return string(s.src[start:s.pos])
+}
@@ -0,0 +1,101 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseRules(t *testing.T) {
+	set, err := trigger.ParseRules(`
+// shared conditions
+let signup = this.event == 'signup'
+let pro = signup && this.plan == 'pro' // paying customers
+
+rule "welcome" when signup then {'welcome': true}
+
+rule "upgrade" priority 10
+  when pro
+  then {'discount': 0.2}
+  else {'discount': 0.0}
+`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var ids []string
+	for _, rule := range set.Rules() {
+		ids = append(ids, rule.ID)
+	}
+	if strings.Join(ids, ",") != "upgrade,welcome" {
+		t.Fatalf("expected rules ordered by priority, got: %v", ids)
+	}
+	tests := []struct {
+		data map[string]interface{}
+		want map[string]interface{}
+	}{
+		{
+			data: map[string]interface{}{"event": "signup", "plan": "pro"},
+			want: map[string]interface{}{"welcome": true, "discount": 0.2},
+		},
+		{
+			data: map[string]interface{}{"event": "signup", "plan": "free"},
+			want: map[string]interface{}{"welcome": true, "discount": 0.0},
+		},
+	}
+	for _, tt := range tests {
+		got := map[string]interface{}{}
+		for _, tr := range set.Triggers() {
+			patch, err := tr.Trigger(tt.data)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			for k, v := range patch {
+				got[k] = v
+			}
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Fatalf("expected %v, got: %v", tt.want, got)
+		}
+	}
+}
+
+func TestParseRules_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		want []string
+	}{
+		{
+			name: "syntax",
+			src:  "rule \"a\" when true {'a': 1}",
+			want: []string{"1:28: expected then in rule a"},
+		},
+		{
+			name: "compile",
+			src: `let broken = this.x ==
+rule "a" when true then {'a': 1}
+rule "b" priority 1 when broken then {'b': 1}
+rule "c" when true
+  then {'c': undefined_var}`,
+			want: []string{"1:23: rule b:", "5:14: rule c:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := trigger.ParseRules(tt.src)
+			setErr, ok := err.(*trigger.RuleSetError)
+			if !ok {
+				t.Fatalf("expected a rule set error, got: %v", err)
+			}
+			if len(setErr.Errors) != len(tt.want) {
+				t.Fatalf("expected %v errors, got: %v", len(tt.want), setErr.Error())
+			}
+			for i, want := range tt.want {
+				if got := setErr.Errors[i].Error(); !strings.HasPrefix(got, want) {
+					t.Fatalf("expected error starting with %q, got: %q", want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,193 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/pkg/errors"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var ErrMaxIterations = errors.New("trigger: rule engine did not reach a fixed point")
+
+// RuleChange records a trigger that changed the document during a RuleEngine run
+type RuleChange struct {
+	// Iteration is the 1-based pass over the triggers the change was made in
+	Iteration int
+	// Trigger is the index of the trigger that made the change
+	Trigger int
+	// Fields are the top-level fields the trigger changed
+	Fields []string
+}
+
+// RunResult is the outcome of a RuleEngine run
+type RunResult struct {
+	// Data is the document once no trigger changes it
+	Data map[string]interface{}
+	// Iterations is the number of passes over the triggers, including the final pass that made no changes
+	Iterations int
+	// Changes records every change made to the document in order
+	Changes []*RuleChange
+}
+
+// CycleError is returned when the triggers oscillate between documents instead of reaching a fixed point
+type CycleError struct {
+	// From is the iteration whose resulting document reoccurred
+	From int
+	// To is the iteration that reproduced the document of From
+	To int
+	// Changes are the changes made by the iterations after From up to & including To
+	Changes []*RuleChange
+	// Expressions holds the trigger expression of each trigger index in Changes
+	Expressions map[int]string
+}
+
+// Error describes the triggers & fields involved in the cycle
+func (c *CycleError) Error() string {
+	var changes []string
+	for _, change := range c.Changes {
+		changes = append(changes, fmt.Sprintf("iteration %v: trigger %v (%s) changed %s",
+			change.Iteration, change.Trigger, strings.TrimSpace(c.Expressions[change.Trigger]), strings.Join(change.Fields, ", ")))
+	}
+	return fmt.Sprintf("trigger: rule cycle detected, iteration %v repeats iteration %v: %s", c.To, c.From, strings.Join(changes, "; "))
+}
+
+type engineOptions struct {
+	maxIterations int
+	strategy      MergeStrategy
+}
+
+// EngineOption configures a RuleEngine
+type EngineOption func(o *engineOptions)
+
+// WithMaxIterations sets the maximum number of passes over the triggers before Run fails with ErrMaxIterations (default: 100)
+func WithMaxIterations(max int) EngineOption {
+	return func(o *engineOptions) {
+		o.maxIterations = max
+	}
+}
+
+// WithEngineMergeStrategy sets how trigger outputs are applied to the document (default: MergeShallow)
+func WithEngineMergeStrategy(strategy MergeStrategy) EngineOption {
+	return func(o *engineOptions) {
+		o.strategy = strategy
+	}
+}
+
+// RuleEngine executes a set of triggers repeatedly until no trigger changes the document
+type RuleEngine struct {
+	triggers []*Trigger
+	options  *engineOptions
+}
+
+// NewRuleEngine creates a RuleEngine that executes the triggers in order on each pass
+func NewRuleEngine(triggers []*Trigger, opts ...EngineOption) *RuleEngine {
+	options := &engineOptions{
+		maxIterations: 100,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	return &RuleEngine{
+		triggers: triggers,
+		options:  options,
+	}
+}
+
+// Run executes the triggers against the Mapper until a pass makes no changes. Within a pass, each trigger sees the
+// changes of the triggers before it. A *CycleError is returned if a pass reproduces the document of an earlier pass
+// & ErrMaxIterations is returned if no fixed point is reached within the maximum number of iterations.
+// Else mutations take part like any other mutation: each pass executes the branch chosen by the trigger's decision
+// against the current document, so a rule whose mutation makes it's own decision deny executes it's else mutation on
+// the next pass. The Mapper is not modified.
+func (r *RuleEngine) Run(data map[string]interface{}) (*RunResult, error) {
+	return r.RunContext(context.Background(), data)
+}
+
+// RunContext is like Run but evaluation is stopped once the context is done
+func (r *RuleEngine) RunContext(ctx context.Context, data map[string]interface{}) (*RunResult, error) {
+	result := &RunResult{
+		Data: copyMap(data),
+	}
+	seen := map[string]int{
+		fingerprint(result.Data): 0,
+	}
+	// first holds the index into result.Changes of the first change of each iteration
+	first := map[int]int{}
+	for iteration := 1; iteration <= r.options.maxIterations; iteration++ {
+		result.Iterations = iteration
+		first[iteration] = len(result.Changes)
+		for i, t := range r.triggers {
+			out, err := t.eval(ctx, map[string]interface{}{
+				"this": result.Data,
+			})
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: rule engine failed on iteration %v, trigger %v", iteration, i)
+			}
+			if out == nil {
+				continue
+			}
+			next, err := applyPatch(result.Data, out, r.options.strategy)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: rule engine failed on iteration %v, trigger %v", iteration, i)
+			}
+			if fields := changedFields(result.Data, next); len(fields) > 0 {
+				result.Changes = append(result.Changes, &RuleChange{
+					Iteration: iteration,
+					Trigger:   i,
+					Fields:    fields,
+				})
+			}
+			result.Data = next
+		}
+		if len(result.Changes) == first[iteration] {
+			return result, nil
+		}
+		key := fingerprint(result.Data)
+		if from, ok := seen[key]; ok {
+			cycle := &CycleError{
+				From:        from,
+				To:          iteration,
+				Changes:     result.Changes[first[from+1]:],
+				Expressions: map[int]string{},
+			}
+			for _, change := range cycle.Changes {
+				cycle.Expressions[change.Trigger] = r.triggers[change.Trigger].expression
+			}
+			return nil, cycle
+		}
+		seen[key] = iteration
+	}
+	return nil, errors.Wrapf(ErrMaxIterations, "%v iterations", r.options.maxIterations)
+}
+
+// changedFields returns the sorted top-level fields whose values differ between the documents
+func changedFields(before, after map[string]interface{}) []string {
+	var fields []string
+	for k, v := range after {
+		if prev, ok := before[k]; !ok || !valuesEqual(prev, v) {
+			fields = append(fields, k)
+		}
+	}
+	for k := range before {
+		if _, ok := after[k]; !ok {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+func valuesEqual(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b) || jsonEqual(a, b)
+}
+
+// fingerprint returns a canonical string representation of the document
+func fingerprint(data map[string]interface{}) string {
+	if bits, err := json.Marshal(data); err == nil {
+		return string(bits)
+	}
+	return fmt.Sprintf("%#v", data)
+}
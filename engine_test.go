@@ -0,0 +1,124 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRuleEngine_Run(t *testing.T) {
+	set, err := trigger.LoadRuleSet(strings.NewReader(`rules:
+  - id: url
+    decision: has(this.slug)
+    mutation: "{'url': '/posts/' + this.slug}"
+  - id: slug
+    decision: has(this.title)
+    mutation: "{'slug': this.title.lowerCase().replace(' ', '-')}"
+`), trigger.RuleFormatYAML)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err := trigger.NewRuleEngine(set.Triggers()).Run(map[string]interface{}{
+		"title": "Hello World",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	want := map[string]interface{}{
+		"title": "Hello World",
+		"slug":  "hello-world",
+		"url":   "/posts/hello-world",
+	}
+	if !reflect.DeepEqual(result.Data, want) {
+		t.Fatalf("expected %v, got: %v", want, result.Data)
+	}
+	if result.Iterations != 3 {
+		t.Fatalf("expected 3 iterations, got: %v", result.Iterations)
+	}
+}
+
+func TestRuleEngine_Run_Cycle(t *testing.T) {
+	engine := trigger.NewRuleEngine([]*trigger.Trigger{
+		mustTrigger(t, "this.state == 'on' => {'state': 'off'}"),
+		mustTrigger(t, "this.state == 'off' && this.count < 2 => {'count': this.count + 1}"),
+		mustTrigger(t, "this.state == 'off' => {'state': 'on'}"),
+	})
+	_, err := engine.Run(map[string]interface{}{
+		"state": "on",
+		"count": 0,
+	})
+	cycle, ok := err.(*trigger.CycleError)
+	if !ok {
+		t.Fatalf("expected a cycle error, got: %v", err)
+	}
+	if cycle.From != 2 || cycle.To != 3 {
+		t.Fatalf("expected iteration 3 to repeat iteration 2, got: %v", cycle.Error())
+	}
+	var triggers []int
+	for _, change := range cycle.Changes {
+		triggers = append(triggers, change.Trigger)
+	}
+	if !reflect.DeepEqual(triggers, []int{0, 2}) {
+		t.Fatalf("expected triggers 0 & 2 in the cycle, got: %v", triggers)
+	}
+
+	counter := trigger.NewRuleEngine([]*trigger.Trigger{
+		mustTrigger(t, "true => {'count': this.count + 1}"),
+	}, trigger.WithMaxIterations(10))
+	if _, err := counter.Run(map[string]interface{}{"count": 0}); errors.Cause(err) != trigger.ErrMaxIterations {
+		t.Fatalf("expected max iterations error, got: %v", err)
+	}
+}
+
+func TestRuleEngine_Run_Else(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules string
+		data  map[string]interface{}
+		want  map[string]interface{}
+		cycle bool
+	}{
+		{
+			name: "else follows later changes",
+			rules: `rule "b" priority 10 when this.stage == 'mid' then {'flag': 'on'} else {'flag': 'off'}
+rule "a" when this.stage == 'start' then {'stage': 'mid'}`,
+			data: map[string]interface{}{"stage": "start"},
+			want: map[string]interface{}{"stage": "mid", "flag": "on"},
+		},
+		{
+			name:  "self negating rule",
+			rules: `rule "r" when this.status == 'new' then {'status': 'processed'} else {'status': 'ignored'}`,
+			data:  map[string]interface{}{"status": "new"},
+			want:  map[string]interface{}{"status": "ignored"},
+		},
+		{
+			name:  "oscillating branches",
+			rules: `rule "r" when this.flag == 'on' then {'flag': 'off'} else {'flag': 'on'}`,
+			data:  map[string]interface{}{"flag": "on"},
+			cycle: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := trigger.ParseRules(tt.rules)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			result, err := trigger.NewRuleEngine(set.Triggers()).Run(tt.data)
+			if tt.cycle {
+				if _, ok := err.(*trigger.CycleError); !ok {
+					t.Fatalf("expected a cycle error, got: %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(result.Data, tt.want) {
+				t.Fatalf("expected %v, got: %v", tt.want, result.Data)
+			}
+		})
+	}
+}
@@ -1,63 +1,361 @@
 package trigger
 
 import (
-	"fmt"
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/checker/decls"
 	"github.com/google/cel-go/interpreter/functions"
 	"github.com/graphikDB/generic"
+	"github.com/pkg/errors"
 	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
-	"os"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"sync"
 	"time"
 )
 
-func init() {
-	var err error
-	var declarations = []*expr.Decl{
-		decls.NewVar("this", decls.NewMapType(decls.String, decls.Any)),
+var (
+	ErrDuplicateFunction = errors.New("trigger: duplicate function")
+	ErrDuplicateOverload = errors.New("trigger: duplicate function overload")
+	ErrInvalidFunction   = errors.New("trigger: invalid function")
+)
+
+// Env is an isolated CEL environment with it's own functions, variables & program cache.
+// Decisions & Triggers are created from an Env.
+type Env struct {
+	mu               sync.RWMutex
+	env              *cel.Env
+	cache            generic.Cache
+	cacheTTL         time.Duration
+	done             chan struct{}
+	closeOnce        sync.Once
+	functions        FuncMap
+	variables        []*expr.Decl
+	schemas          map[string]*Schema
+	types            []proto.Message
+	limits           Limits
+	maxEstimatedCost int64
+	onDecisionError  DecisionErrorPolicy
+	overloads        []*functions.Overload
+}
+
+type envOptions struct {
+	functions        []FuncMap
+	variables        []*expr.Decl
+	schemas          map[string]*Schema
+	types            []proto.Message
+	limits           Limits
+	maxEstimatedCost int64
+	onDecisionError  DecisionErrorPolicy
+	cacheGC          time.Duration
+	cacheTTL         time.Duration
+}
+
+// EnvOption configures an Env
+type EnvOption func(o *envOptions)
+
+// WithCacheTTL sets how long compiled programs are cached for (default: 5 minutes)
+func WithCacheTTL(ttl time.Duration) EnvOption {
+	return func(o *envOptions) {
+		o.cacheTTL = ttl
 	}
-	for _, function := range Functions {
-		declarations = append(declarations, function.decl)
+}
+
+// WithCacheGC sets how often expired programs are evicted from the cache (default: 1 minute)
+func WithCacheGC(interval time.Duration) EnvOption {
+	return func(o *envOptions) {
+		o.cacheGC = interval
 	}
-	env, err := cel.NewEnv(cel.Declarations(declarations...))
-	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+}
+
+// WithFunctions registers custom functions in addition to the package level Functions
+func WithFunctions(funcs FuncMap) EnvOption {
+	return func(o *envOptions) {
+		o.functions = append(o.functions, funcs)
 	}
-	globalEnv = &environment{
-		env:   env,
-		cache: generic.NewCache(1 * time.Minute),
+}
+
+// WithVariable declares an input variable of the given type that may be referenced by expressions & passed to EvalVars.
+// The variable "this" is declared as map(string, dyn) unless it is redeclared with WithVariable.
+func WithVariable(name string, typ *expr.Type) EnvOption {
+	return func(o *envOptions) {
+		for i, v := range o.variables {
+			if v.GetName() == name {
+				o.variables[i] = decls.NewVar(name, typ)
+				return
+			}
+		}
+		o.variables = append(o.variables, decls.NewVar(name, typ))
 	}
 }
 
-type environment struct {
-	env   *cel.Env
-	cache generic.Cache
+// WithSchema declares an input variable whose shape is described by the schema. Expressions referencing unknown fields
+// or mismatching types fail to compile. Map & struct inputs are converted to the schema's type before evaluation.
+func WithSchema(name string, schema *Schema) EnvOption {
+	return func(o *envOptions) {
+		WithVariable(name, schema.Type())(o)
+		o.schemas[name] = schema
+	}
 }
 
-func (e *environment) Program(expression string) (cel.Program, error) {
-	if val, ok := e.cache.Get(expression); ok {
-		if program, ok := val.(cel.Program); ok {
-			return program, nil
+// NewEnv creates a new Env. By default the Env is configured with the package level Functions.
+func NewEnv(opts ...EnvOption) (*Env, error) {
+	options := &envOptions{
+		variables: []*expr.Decl{
+			decls.NewVar("this", decls.NewMapType(decls.String, decls.Any)),
+		},
+		schemas:  map[string]*Schema{},
+		cacheGC:  1 * time.Minute,
+		cacheTTL: 5 * time.Minute,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	e := &Env{
+		// expired programs are evicted by the Env so the eviction can be stopped by Close
+		cache:            generic.NewCache(0),
+		cacheTTL:         options.cacheTTL,
+		done:             make(chan struct{}),
+		functions:        FuncMap{},
+		variables:        options.variables,
+		schemas:          options.schemas,
+		types:            options.types,
+		limits:           options.limits,
+		maxEstimatedCost: options.maxEstimatedCost,
+		onDecisionError:  options.onDecisionError,
+	}
+	for name, function := range Functions {
+		e.functions[name] = function
+	}
+	for _, funcs := range options.functions {
+		for name, function := range funcs {
+			if err := e.addFunction(name, function); err != nil {
+				return nil, err
+			}
 		}
 	}
-	ast, iss := globalEnv.env.Compile(expression)
-	if iss.Err() != nil {
-		return nil, iss.Err()
+	if err := e.build(); err != nil {
+		return nil, err
+	}
+	if options.cacheGC > 0 {
+		go e.evict(options.cacheGC)
+	}
+	return e, nil
+}
+
+// Close stops evicting expired programs from the Env's cache. The Env remains usable, but expired programs are only
+// replaced once they're compiled again. Close has no effect on the package level default Env.
+func (e *Env) Close() {
+	if e == defaultEnv {
+		return
 	}
+	e.closeOnce.Do(func() {
+		close(e.done)
+	})
+}
+
+// evict removes expired programs from the cache every interval until the Env is closed
+func (e *Env) evict(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-e.done:
+			return
+		case now := <-ticker.C:
+			e.cache.Range(func(key, value interface{}) bool {
+				if c, ok := value.(*compiled); ok && c.expired(now) {
+					e.cache.Delete(key)
+				}
+				return true
+			})
+		}
+	}
+}
+
+// RegisterFunction adds a custom function to the Env. Cached programs are invalidated, but Decisions & Triggers
+// that have already been created are unaffected.
+func (e *Env) RegisterFunction(name string, decl *expr.Decl, overload *functions.Overload) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if err := e.addFunction(name, NewFunction(decl, overload)); err != nil {
+		return err
+	}
+	if err := e.build(); err != nil {
+		delete(e.functions, name)
+		return err
+	}
+	e.cache.Range(func(key, value interface{}) bool {
+		e.cache.Delete(key)
+		return true
+	})
+	return nil
+}
+
+func (e *Env) addFunction(name string, function *Function) error {
+	if function == nil || function.decl == nil || function.overload == nil || function.decl.GetFunction() == nil {
+		return errors.Wrapf(ErrInvalidFunction, "%s: missing function declaration or overload", name)
+	}
+	if function.decl.GetName() != name {
+		return errors.Wrapf(ErrInvalidFunction, "%s: declaration name = %s", name, function.decl.GetName())
+	}
+	if _, ok := e.functions[name]; ok {
+		return errors.Wrap(ErrDuplicateFunction, name)
+	}
+	var declared bool
+	for _, o := range function.decl.GetFunction().GetOverloads() {
+		if o.GetOverloadId() == function.overload.Operator {
+			declared = true
+		}
+		for existing, f := range e.functions {
+			for _, eo := range f.decl.GetFunction().GetOverloads() {
+				if eo.GetOverloadId() == o.GetOverloadId() {
+					return errors.Wrapf(ErrDuplicateOverload, "%s: overload %s already declared by %s", name, o.GetOverloadId(), existing)
+				}
+			}
+		}
+	}
+	if !declared {
+		return errors.Wrapf(ErrInvalidFunction, "%s: overload %s is not declared", name, function.overload.Operator)
+	}
+	e.functions[name] = function
+	return nil
+}
+
+func (e *Env) build() error {
+	var declarations = append([]*expr.Decl{}, e.variables...)
 	var overloads []*functions.Overload
-	for _, function := range Functions {
+	for _, function := range e.functions {
+		declarations = append(declarations, function.decl)
 		overloads = append(overloads, function.overload)
 	}
-	program, err := globalEnv.env.Program(
-		ast,
-		cel.Functions(overloads...),
-	)
+	var opts []cel.EnvOption
+	if len(e.types) > 0 {
+		var types []interface{}
+		for _, typ := range e.types {
+			types = append(types, typ)
+		}
+		opts = append(opts, cel.Types(types...))
+	}
+	schemaTypes := map[protoreflect.FullName]*Schema{}
+	for name, schema := range e.schemas {
+		if other, ok := schemaTypes[schema.message.FullName()]; ok && other.message != schema.message {
+			return errors.Wrapf(ErrInvalidSchema, "schema of %s has the same type name as another schema: %s", name, schema.message.FullName())
+		}
+		schemaTypes[schema.message.FullName()] = schema
+		if schema.typ != nil {
+			opts = append(opts, cel.Types(schema.typ))
+		} else {
+			opts = append(opts, cel.TypeDescs(schema.file))
+		}
+	}
+	opts = append(opts, cel.Declarations(declarations...))
+	env, err := cel.NewEnv(opts...)
+	if err != nil {
+		return errors.Wrap(err, "trigger: failed to create environment")
+	}
+	e.env = env
+	e.overloads = overloads
+	return nil
+}
+
+type compiled struct {
+	ast     *cel.Ast
+	program cel.Program
+	// expires is when the program is evicted from the cache. It is zero if the program never expires.
+	expires time.Time
+}
+
+func (c *compiled) expired(now time.Time) bool {
+	return !c.expires.IsZero() && now.After(c.expires)
+}
+
+func (e *Env) compile(expression string) (*compiled, error) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if val, ok := e.cache.Get(expression); ok {
+		if c, ok := val.(*compiled); ok && !c.expired(time.Now()) {
+			return c, nil
+		}
+	}
+	ast, iss := e.env.Compile(expression)
+	if iss.Err() != nil {
+		return nil, newCompileError(expression, iss)
+	}
+	program, err := e.program(ast)
 	if err != nil {
 		return nil, err
 	}
-	e.cache.Set(expression, program, 5*time.Minute)
-	return program, nil
+	c := &compiled{
+		ast:     ast,
+		program: program,
+	}
+	if e.cacheTTL > 0 {
+		c.expires = time.Now().Add(e.cacheTTL)
+	}
+	e.cache.Set(expression, c, 0)
+	return c, nil
+}
+
+// program plans the checked expression with the Env's functions. The caller must hold e.mu.
+func (e *Env) program(ast *cel.Ast, opts ...cel.ProgramOption) (cel.Program, error) {
+	opts = append([]cel.ProgramOption{
+		cel.Functions(e.overloads...),
+		cel.CustomDecorator(newControlDecorator(ast.Expr())),
+	}, opts...)
+	return e.env.Program(ast, opts...)
+}
+
+// vars converts input variables that are described by a Schema into the schema's type
+func (e *Env) vars(vars map[string]interface{}) (map[string]interface{}, error) {
+	if len(e.schemas) == 0 {
+		return vars, nil
+	}
+	converted := make(map[string]interface{}, len(vars))
+	for name, value := range vars {
+		if schema, ok := e.schemas[name]; ok {
+			val, err := schema.convert(value)
+			if err != nil {
+				return nil, err
+			}
+			value = val
+		}
+		converted[name] = value
+	}
+	return converted, nil
+}
+
+// Issue is a single problem found while parsing or type-checking an expression
+type Issue struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+// CompileError is returned when an expression fails to parse or type-check
+type CompileError struct {
+	Expression string
+	Issues     []Issue
+	err        error
+}
+
+func newCompileError(expression string, iss *cel.Issues) *CompileError {
+	c := &CompileError{
+		Expression: expression,
+		err:        iss.Err(),
+	}
+	for _, e := range iss.Errors() {
+		c.Issues = append(c.Issues, Issue{
+			Line:    e.Location.Line(),
+			Column:  e.Location.Column() + 1,
+			Message: e.Message,
+		})
+	}
+	return c
+}
+
+// Error implements the error interface
+func (c *CompileError) Error() string {
+	return c.err.Error()
 }
 
-var globalEnv *environment
+var defaultEnv, defaultEnvErr = NewEnv()
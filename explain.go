@@ -0,0 +1,318 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Explanation is a trace of every sub-expression evaluated by a Decision
+type Explanation struct {
+	// Expression is the decision's raw expression
+	Expression string
+	// Allowed is true if the decision evaluated to true
+	Allowed bool
+	// Steps holds each evaluated sub-expression ordered by source position, outer expressions first
+	Steps []*ExplainStep
+}
+
+// ExplainStep is a single evaluated sub-expression of a Decision
+type ExplainStep struct {
+	// ID is the id of the sub-expression within the checked expression
+	ID int64
+	// Expression is the source text of the sub-expression
+	Expression string
+	// Start & End are the offsets of the sub-expression within the decision's source
+	Start int
+	End   int
+	// Line & Column are the 1-based location of the sub-expression's start
+	Line   int
+	Column int
+	// Value is the evaluated value of the sub-expression
+	Value interface{}
+	// Error is set if the sub-expression evaluated to an error
+	Error string
+
+	children []int64
+}
+
+// String returns the step as: ${expression} = ${value}
+func (s *ExplainStep) String() string {
+	if s.Error != "" {
+		return fmt.Sprintf("%s = error(%s)", s.Expression, s.Error)
+	}
+	return fmt.Sprintf("%s = %v", s.Expression, s.Value)
+}
+
+// Reasons returns the innermost boolean sub-expressions that evaluated to false, ie the clauses that caused a denial
+func (e *Explanation) Reasons() []*ExplainStep {
+	steps := map[int64]*ExplainStep{}
+	for _, step := range e.Steps {
+		steps[step.ID] = step
+	}
+	var reasons []*ExplainStep
+	for _, step := range e.Steps {
+		if step.Value != false {
+			continue
+		}
+		innermost := true
+		for _, child := range step.children {
+			if c, ok := steps[child]; ok && c.Value == false {
+				innermost = false
+				break
+			}
+		}
+		if innermost {
+			reasons = append(reasons, step)
+		}
+	}
+	return reasons
+}
+
+// String returns a human readable description of why the decision was denied or allowed
+func (e *Explanation) String() string {
+	if e.Allowed {
+		return fmt.Sprintf("%s = true", strings.TrimSpace(e.Expression))
+	}
+	var reasons []string
+	for _, reason := range e.Reasons() {
+		reasons = append(reasons, reason.String())
+	}
+	if len(reasons) == 0 {
+		for _, step := range e.Steps {
+			if step.Error != "" {
+				reasons = append(reasons, step.String())
+			}
+		}
+	}
+	return fmt.Sprintf("denied: %s", strings.Join(reasons, ", "))
+}
+
+// Explain evaluates the decision against the Mapper & returns a trace of every evaluated sub-expression.
+// Short-circuiting is disabled so every clause of the decision is reported. The Env's Limits apply to the whole trace.
+func (n *Decision) Explain(data map[string]interface{}) (*Explanation, error) {
+	return n.ExplainVars(map[string]interface{}{
+		"this": data,
+	})
+}
+
+// ExplainVars is like Explain but evaluates the decision against the named input variables declared in the Env
+func (n *Decision) ExplainVars(vars map[string]interface{}) (*Explanation, error) {
+	return n.explainVars(context.Background(), vars)
+}
+
+// explainVars traces the decision within the Env's Limits. Every branch is evaluated, so a decision that exceeds a
+// limit fails with ErrCostLimitExceeded rather than being explained.
+func (n *Decision) explainVars(ctx context.Context, vars map[string]interface{}) (*Explanation, error) {
+	n.explainOnce.Do(func() {
+		n.env.mu.RLock()
+		defer n.env.mu.RUnlock()
+		n.explainProgram, n.explainErr = n.env.program(n.ast, cel.EvalOptions(cel.OptExhaustiveEval))
+	})
+	if n.explainErr != nil {
+		return nil, errors.Wrapf(n.explainErr, "trigger: failed to explain decision (%s)", n.expression)
+	}
+	vars, err := n.env.vars(vars)
+	if err != nil {
+		return nil, err
+	}
+	ctrl := newControl(ctx, n.env.limits)
+	out, details, err := n.explainProgram.Eval(ctrl.activation(vars))
+	if ctrlErr := ctrl.err(); ctrlErr != nil {
+		return nil, errors.Wrapf(ctrlErr, "trigger: failed to explain decision (%s)", n.expression)
+	}
+	if details == nil {
+		return nil, errors.Wrapf(err, "trigger: failed to explain decision (%s)", n.expression)
+	}
+	explanation := &Explanation{
+		Expression: n.expression,
+	}
+	if out != nil {
+		if val, ok := out.Value().(bool); ok && val {
+			explanation.Allowed = true
+		}
+	}
+	source := []rune(n.ast.Source().Content())
+	positions := n.ast.SourceInfo().GetPositions()
+	state := details.State()
+	// field selections are evaluated as a single attribute so the value of the operand isn't tracked separately
+	operands := map[int64]bool{}
+	walkExpr(n.ast.Expr(), func(e *expr.Expr) {
+		if sel := e.GetSelectExpr(); sel != nil {
+			operands[sel.GetOperand().GetId()] = true
+		}
+	})
+	walkSteps(n.ast.Expr(), func(e *expr.Expr, subtree []int64, children []int64) {
+		val, ok := state.Value(e.GetId())
+		if !ok || operands[e.GetId()] {
+			return
+		}
+		start, end := span(source, positions, subtree)
+		if start < 0 {
+			return
+		}
+		step := &ExplainStep{
+			ID:         e.GetId(),
+			Expression: string(source[start:end]),
+			Start:      start,
+			End:        end,
+			children:   children,
+		}
+		if loc, ok := n.ast.Source().OffsetLocation(int32(start)); ok {
+			step.Line = loc.Line()
+			step.Column = loc.Column() + 1
+		}
+		switch {
+		case types.IsError(val):
+			step.Error = fmt.Sprint(val.Value())
+		case types.IsUnknown(val):
+			step.Error = "unknown"
+		default:
+			step.Value = val.Value()
+		}
+		explanation.Steps = append(explanation.Steps, step)
+	})
+	sort.SliceStable(explanation.Steps, func(i, j int) bool {
+		if explanation.Steps[i].Start != explanation.Steps[j].Start {
+			return explanation.Steps[i].Start < explanation.Steps[j].Start
+		}
+		return explanation.Steps[i].End > explanation.Steps[j].End
+	})
+	return explanation, nil
+}
+
+// walkSteps calls fn with each user-written sub-expression, it's subtree ids & it's direct children ids.
+// The accumulator, condition, step & result of comprehensions are generated by macros so they're skipped.
+func walkSteps(e *expr.Expr, fn func(e *expr.Expr, subtree []int64, children []int64)) []int64 {
+	if e == nil {
+		return nil
+	}
+	var children []*expr.Expr
+	switch k := e.GetExprKind().(type) {
+	case *expr.Expr_SelectExpr:
+		children = append(children, k.SelectExpr.GetOperand())
+	case *expr.Expr_CallExpr:
+		if k.CallExpr.GetTarget() != nil {
+			children = append(children, k.CallExpr.GetTarget())
+		}
+		children = append(children, k.CallExpr.GetArgs()...)
+	case *expr.Expr_ListExpr:
+		children = append(children, k.ListExpr.GetElements()...)
+	case *expr.Expr_StructExpr:
+		for _, entry := range k.StructExpr.GetEntries() {
+			if entry.GetMapKey() != nil {
+				children = append(children, entry.GetMapKey())
+			}
+			children = append(children, entry.GetValue())
+		}
+	case *expr.Expr_ComprehensionExpr:
+		children = append(children, k.ComprehensionExpr.GetIterRange())
+	}
+	subtree := []int64{e.GetId()}
+	var childIDs []int64
+	for _, child := range children {
+		subtree = append(subtree, walkSteps(child, fn)...)
+		childIDs = append(childIDs, child.GetId())
+	}
+	fn(e, subtree, childIDs)
+	return subtree
+}
+
+// span approximates the source offsets of an expression from the positions of the nodes in it's subtree
+func span(source []rune, positions map[int64]int32, subtree []int64) (int, int) {
+	start, end := -1, -1
+	for _, id := range subtree {
+		pos, ok := positions[id]
+		if !ok || int(pos) >= len(source) {
+			continue
+		}
+		if start < 0 || int(pos) < start {
+			start = int(pos)
+		}
+		if tokenEnd := tokenEnd(source, int(pos)); tokenEnd > end {
+			end = tokenEnd
+		}
+	}
+	if start < 0 {
+		return -1, -1
+	}
+	// global calls are positioned at their opening parenthesis, ex: size(this.email), so include the function name
+	if source[start] == '(' {
+		for start > 0 && (unicode.IsLetter(source[start-1]) || unicode.IsDigit(source[start-1]) || source[start-1] == '_') {
+			start--
+		}
+	}
+	// include closing brackets of calls, lists & maps that start within the span
+	depth := 0
+	for i := start; i < end; i++ {
+		switch r := source[i]; {
+		case r == '\'' || r == '"':
+			i = stringEnd(source, i) - 1
+		case r == '(' || r == '[' || r == '{':
+			depth++
+		case r == ')' || r == ']' || r == '}':
+			depth--
+		}
+	}
+	for end < len(source) && depth > 0 {
+		switch source[end] {
+		case ')', ']', '}':
+			depth--
+		case ' ', '\t', '\n', '\r':
+		default:
+			return start, end
+		}
+		end++
+	}
+	return start, end
+}
+
+// stringEnd returns the offset following the string literal that starts at pos, including triple quoted & raw
+// literals, or the end of the source if the literal is unterminated
+func stringEnd(source []rune, pos int) int {
+	if end := skipString(source, pos); end >= 0 {
+		return end
+	}
+	return len(source)
+}
+
+// tokenEnd returns the offset following the token that starts at pos
+func tokenEnd(source []rune, pos int) int {
+	isIdent := func(r rune) bool {
+		return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+	}
+	i := pos
+	switch r := source[i]; {
+	case r == '\'' || r == '"':
+		return stringEnd(source, i)
+	case r == '.':
+		i++
+		for i < len(source) && isIdent(source[i]) {
+			i++
+		}
+		return i
+	case isIdent(r):
+		for i < len(source) && (isIdent(source[i]) || source[i] == '.' && r >= '0' && r <= '9') {
+			i++
+		}
+		// raw & bytes string literals are positioned at their prefix, ex: r'\d'
+		if i < len(source) && (source[i] == '\'' || source[i] == '"') && i-pos <= 2 && strings.Trim(string(source[pos:i]), "rRbB") == "" {
+			return stringEnd(source, i)
+		}
+		return i
+	default:
+		for i < len(source) && strings.ContainsRune("=!<>&|+-*/%?:", source[i]) {
+			i++
+		}
+		if i == pos {
+			i++
+		}
+		return i
+	}
+}
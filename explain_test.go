@@ -0,0 +1,80 @@
+package trigger_test
+
+import (
+	"github.com/google/cel-go/checker/decls"
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func TestDecision_Explain(t *testing.T) {
+	decision, err := trigger.NewDecision("this.role == 'admin' && this.org == 'acme'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	explanation, err := decision.Explain(map[string]interface{}{
+		"role": "admin",
+		"org":  "globex",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if explanation.Allowed {
+		t.Fatal("expected decision to be denied")
+	}
+	for _, step := range explanation.Steps {
+		t.Logf("%d:%d [%d, %d) %s", step.Line, step.Column, step.Start, step.End, step.String())
+	}
+	reasons := explanation.Reasons()
+	if len(reasons) != 1 {
+		t.Fatalf("expected 1 reason, got %v", len(reasons))
+	}
+	if reasons[0].Expression != "this.org == 'acme'" || reasons[0].Start != 24 || reasons[0].Column != 25 {
+		t.Fatalf("unexpected reason: %v", reasons[0])
+	}
+	if explanation.String() != "denied: this.org == 'acme' = false" {
+		t.Fatalf("unexpected explanation: %s", explanation.String())
+	}
+	explanation, err = decision.Explain(map[string]interface{}{
+		"role": "admin",
+		"org":  "acme",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !explanation.Allowed {
+		t.Fatal("expected decision to be allowed")
+	}
+}
+
+func TestDecision_Explain_Limits(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("this", decls.NewMapType(decls.String, decls.Dyn)),
+		trigger.WithLimits(trigger.Limits{MaxIterations: 5}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("this.items.all(i, i > 0)")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var items []interface{}
+	for i := 1; i <= 100; i++ {
+		items = append(items, i)
+	}
+	if _, err := decision.Explain(map[string]interface{}{
+		"items": items,
+	}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got: %v", err)
+	}
+	explanation, err := decision.Explain(map[string]interface{}{
+		"items": items[:3],
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !explanation.Allowed {
+		t.Fatalf("expected allowed, got: %s", explanation)
+	}
+}
@@ -1,10 +1,21 @@
 package trigger_test
 
 import (
+	"context"
 	"fmt"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/interpreter/functions"
 	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"math"
 	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"time"
 )
 
 func Test(t *testing.T) {
@@ -418,3 +429,281 @@ func TestTrigger_Trigger(t1 *testing.T) {
 		})
 	}
 }
+
+func TestNewEnv(t *testing.T) {
+	env, err := trigger.NewEnv(trigger.WithCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	trigg, err := env.NewArrowTrigger("this.name == 'bob' => {'name': this.name.upperCase()}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	data, err := trigg.Trigger(map[string]interface{}{
+		"name": "bob",
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if data["name"] != "BOB" {
+		t.Fatalf("expected BOB, got %v", data["name"])
+	}
+}
+
+func TestEnv_Close(t *testing.T) {
+	before := runtime.NumGoroutine()
+	for i := 0; i < 50; i++ {
+		env, err := trigger.NewEnv(trigger.WithCacheGC(time.Millisecond), trigger.WithCacheTTL(time.Millisecond))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		env.Close()
+		env.Close()
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before+5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected closed Envs to stop their goroutines: %v before, %v after", before, runtime.NumGoroutine())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	env, err := trigger.NewEnv(trigger.WithCacheTTL(time.Millisecond))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env.Close()
+	for i := 0; i < 2; i++ {
+		decision, err := env.NewDecision("this.name == 'bob'")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := decision.Eval(map[string]interface{}{"name": "bob"}); err != nil {
+			t.Fatal(err.Error())
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+}
+
+func TestEnv_RegisterFunction(t *testing.T) {
+	env, err := trigger.NewEnv()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tenantOf := func(value ref.Val) ref.Val {
+		return types.String(strings.Split(value.Value().(string), "@")[1])
+	}
+	if err := env.RegisterFunction("tenantOf",
+		decls.NewFunction("tenantOf", decls.NewInstanceOverload("tenantOf_string", []*expr.Type{decls.String}, decls.String)),
+		&functions.Overload{Operator: "tenantOf_string", Unary: tenantOf},
+	); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := env.RegisterFunction("tenantOf",
+		decls.NewFunction("tenantOf", decls.NewInstanceOverload("tenantOf_string", []*expr.Type{decls.String}, decls.String)),
+		&functions.Overload{Operator: "tenantOf_string", Unary: tenantOf},
+	); errors.Cause(err) != trigger.ErrDuplicateFunction {
+		t.Fatalf("expected duplicate function error, got %v", err)
+	}
+	decision, err := env.NewDecision("this.email.tenantOf() == 'acme.com'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.Eval(map[string]interface{}{
+		"email": "bob@acme.com",
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := trigger.NewDecision("this.email.tenantOf() == 'acme.com'"); err == nil {
+		t.Fatal("expected tenantOf to be undeclared in the default env")
+	}
+}
+
+func TestDecision_EvalVars(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("user", decls.NewMapType(decls.String, decls.Any)),
+		trigger.WithVariable("resource", decls.NewMapType(decls.String, decls.Any)),
+		trigger.WithVariable("now", decls.Int),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("user.org == resource.org && resource.expires > now")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalVars(map[string]interface{}{
+		"user":     map[string]interface{}{"org": "acme"},
+		"resource": map[string]interface{}{"org": "acme", "expires": 200},
+		"now":      100,
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalVars(map[string]interface{}{
+		"user":     map[string]interface{}{"org": "acme"},
+		"resource": map[string]interface{}{"org": "acme", "expires": 50},
+		"now":      100,
+	}); err != trigger.ErrDecisionDenied {
+		t.Fatalf("expected decision to be denied, got %v", err)
+	}
+	trigg, err := env.NewTrigger(decision, "{'owner': user.org}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	data, err := trigg.EvalVars(map[string]interface{}{
+		"user":     map[string]interface{}{"org": "acme"},
+		"resource": map[string]interface{}{"org": "acme", "expires": 200},
+		"now":      100,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if data["owner"] != "acme" {
+		t.Fatalf("expected owner = acme, got %v", data["owner"])
+	}
+}
+
+func TestDecision_EvalContext(t *testing.T) {
+	env, err := trigger.NewEnv(trigger.WithVariable("this", decls.NewMapType(decls.String, decls.Dyn)))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("this.items.map(i, string(i).sha256()).exists(h, h == 'none')")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var items []interface{}
+	for i := 0; i < 200000; i++ {
+		items = append(items, i)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	err = decision.EvalContext(ctx, map[string]interface{}{
+		"items": items,
+	})
+	if errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("expected evaluation to stop shortly after the deadline, took %s", time.Since(start))
+	}
+	trigg, err := env.NewTrigger(decision, "{'found': true}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	cancel()
+	if _, err := trigg.TriggerContext(ctx, map[string]interface{}{
+		"items": items,
+	}); errors.Cause(err) != context.DeadlineExceeded {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("this", decls.NewMapType(decls.String, decls.Dyn)),
+		trigger.WithLimits(trigger.Limits{
+			MaxIterations:   100,
+			MaxStringLength: 64,
+			MaxOutputSize:   2,
+		}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var items []interface{}
+	for i := 0; i < 1000; i++ {
+		items = append(items, i)
+	}
+	decision, err := env.NewDecision("this.items.exists(i, i == -1) || true")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.Eval(map[string]interface{}{
+		"items": items,
+	}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+	if err := decision.Eval(map[string]interface{}{
+		"items": items[:10],
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalContext(trigger.ContextWithLimits(context.Background(), trigger.Limits{MaxCost: 5}), map[string]interface{}{
+		"items": items[:10],
+	}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+	trigg, err := env.NewArrowTrigger("this.items.all(i, i >= 0) => {'valid': true}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// a decision that exceeds a limit fails regardless of the trigger's DecisionErrorPolicy
+	if _, err := trigg.Trigger(map[string]interface{}{
+		"items": items,
+	}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+	trigg, err = env.NewArrowTrigger("true => {'text': this.text.replace('a', 'aaaaaaaaaa')}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := trigg.Trigger(map[string]interface{}{
+		"text": "aaaaaaaaaa",
+	}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+	trigg, err = env.NewArrowTrigger("true => {'a': 1, 'b': 2, 'c': 3}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := trigg.Trigger(map[string]interface{}{}); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+}
+
+func TestDecision_EstimateCost(t *testing.T) {
+	decision, err := trigger.NewDecision("this.name == 'bob' && this.email.endsWith('acme.com')")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	min, max := decision.EstimateCost()
+	if min <= 0 || max < min || max == math.MaxInt64 {
+		t.Fatalf("unexpected cost estimate: [%v, %v]", min, max)
+	}
+	unbounded, err := trigger.NewDecision("[this.name, this.email].exists(t, t == 'admin')")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, max := unbounded.EstimateCost(); max != math.MaxInt64 {
+		t.Fatalf("expected unbounded cost, got %v", max)
+	}
+	env, err := trigger.NewEnv(trigger.WithMaxEstimatedCost(100))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := env.NewDecision("this.name == 'bob' && this.email.endsWith('acme.com')"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := env.NewDecision("[this.name, this.email].exists(t, t == 'admin')"); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got %v", err)
+	}
+	trigg, err := trigger.NewTrigger(nil, "{'a': this.name + '!'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if min, max := trigg.EstimateCost(); min <= 0 || max < min {
+		t.Fatalf("unexpected cost estimate without a decision: [%v, %v]", min, max)
+	}
+	trigg, err = trigger.NewArrowTrigger("this.name == 'bob' => {'a': 1}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	withElse, err := trigg.WithElse("{'names': [this.name, this.email].filter(t, t != '')}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, max := withElse.EstimateCost(); max != math.MaxInt64 {
+		t.Fatalf("expected the else mutation's unbounded cost, got %v", max)
+	}
+}
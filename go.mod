@@ -9,12 +9,16 @@ require (
 	github.com/google/cel-go v0.6.1-0.20201210004405-3ea8bd382b11
 	github.com/google/uuid v1.1.2
 	github.com/graphikDB/generic v0.1.0
+	github.com/hashicorp/hcl/v2 v2.8.0
 	github.com/huandu/xstrings v1.3.2 // indirect
 	github.com/imdario/mergo v0.3.11 // indirect
 	github.com/mitchellh/copystructure v1.0.0 // indirect
 	github.com/paulmach/orb v0.1.7
 	github.com/pkg/errors v0.9.1
 	github.com/spf13/cast v1.3.1
-	golang.org/x/crypto v0.0.0-20190308221718-c2843e01d9a2
+	github.com/zclconf/go-cty v1.2.0
+	golang.org/x/crypto v0.0.0-20190426145343-a29dc8fdc734
 	google.golang.org/genproto v0.0.0-20201102152239-715cce707fb0
+	google.golang.org/protobuf v1.25.0
+	gopkg.in/yaml.v3 v3.0.0-20200615113413-eeeca48fe776
 )
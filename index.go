@@ -0,0 +1,288 @@
+package trigger
+
+import (
+	"fmt"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/operators"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"strings"
+)
+
+// IndexOp is the kind of lookup an IndexPredicate performs
+type IndexOp int
+
+const (
+	// IndexEquals matches documents whose field equals Values[0]
+	IndexEquals IndexOp = iota
+	// IndexIn matches documents whose field equals any of the Values
+	IndexIn
+	// IndexPrefix matches documents whose string field starts with Values[0]
+	IndexPrefix
+	// IndexRange matches documents whose numeric field is within Min & Max. A nil bound is unbounded.
+	IndexRange
+)
+
+// String returns the name of the operation
+func (o IndexOp) String() string {
+	switch o {
+	case IndexEquals:
+		return "equals"
+	case IndexIn:
+		return "in"
+	case IndexPrefix:
+		return "prefix"
+	case IndexRange:
+		return "range"
+	}
+	return "unknown"
+}
+
+// IndexPredicate is a condition on a single field that may be answered by a secondary index
+type IndexPredicate struct {
+	// Path is the field path, ex: [this email]
+	Path []string
+	// Op is the kind of lookup
+	Op IndexOp
+	// Values holds the values of IndexEquals, IndexIn & IndexPrefix lookups
+	Values []interface{}
+	// Min, Max, MinInclusive & MaxInclusive hold the bounds of IndexRange lookups
+	Min          interface{}
+	Max          interface{}
+	MinInclusive bool
+	MaxInclusive bool
+}
+
+// Field returns the dot separated field path, ex: this.email
+func (p *IndexPredicate) Field() string {
+	return strings.Join(p.Path, ".")
+}
+
+// String returns a human readable representation of the predicate
+func (p *IndexPredicate) String() string {
+	if p.Op != IndexRange {
+		return fmt.Sprintf("%s %s %v", p.Field(), p.Op, p.Values)
+	}
+	lower, upper := "(", ")"
+	if p.MinInclusive {
+		lower = "["
+	}
+	if p.MaxInclusive {
+		upper = "]"
+	}
+	return fmt.Sprintf("%s %s %s%v, %v%s", p.Field(), p.Op, lower, p.Min, p.Max, upper)
+}
+
+// QueryPlan splits a Decision into index lookups & a residual Decision
+type QueryPlan struct {
+	// Predicates must all hold for a document to satisfy the decision. They may be used to narrow candidates via indexes.
+	Predicates []*IndexPredicate
+	// Residual is the remainder of the decision that must be evaluated against each candidate. It is nil if
+	// the predicates fully describe the decision.
+	Residual *Decision
+}
+
+// QueryPlan extracts indexable predicates from the top-level conjunction of the decision: equality on a field,
+// in lists, prefix matches via startsWith & numeric ranges. Any other condition is kept in the plan's residual.
+func (n *Decision) QueryPlan() (*QueryPlan, error) {
+	plan := &QueryPlan{}
+	var residual []string
+	ranges := map[string]*IndexPredicate{}
+	for _, conjunct := range conjuncts(n.ast.Expr()) {
+		predicate, ok := indexPredicate(conjunct)
+		if !ok {
+			expression, err := n.unparse(conjunct)
+			if err != nil {
+				return nil, errors.Wrapf(err, "trigger: failed to plan decision (%s)", n.expression)
+			}
+			residual = append(residual, expression)
+			continue
+		}
+		if predicate.Op == IndexRange {
+			if existing, ok := ranges[predicate.Field()]; ok {
+				mergeRange(existing, predicate)
+				continue
+			}
+			ranges[predicate.Field()] = predicate
+		}
+		plan.Predicates = append(plan.Predicates, predicate)
+	}
+	if len(residual) == 0 {
+		return plan, nil
+	}
+	if len(residual) == 1 {
+		residual[0] = strings.TrimSpace(residual[0])
+	} else {
+		for i, r := range residual {
+			residual[i] = fmt.Sprintf("(%s)", strings.TrimSpace(r))
+		}
+	}
+	decision, err := n.env.NewDecision(strings.Join(residual, " && "))
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to plan decision (%s)", n.expression)
+	}
+	plan.Residual = decision
+	return plan, nil
+}
+
+// unparse returns the source of a sub-expression of the decision. Comprehensions can't be unparsed, so conjuncts
+// containing a macro such as exists or all are sliced from the decision's source instead.
+func (n *Decision) unparse(e *expr.Expr) (string, error) {
+	var subtree []int64
+	var comprehension bool
+	walkExpr(e, func(e *expr.Expr) {
+		subtree = append(subtree, e.GetId())
+		if e.GetComprehensionExpr() != nil {
+			comprehension = true
+		}
+	})
+	if !comprehension {
+		return cel.AstToString(cel.ParsedExprToAst(&expr.ParsedExpr{
+			Expr:       e,
+			SourceInfo: n.ast.SourceInfo(),
+		}))
+	}
+	source := []rune(n.ast.Source().Content())
+	start, end := span(source, n.ast.SourceInfo().GetPositions(), subtree)
+	if start < 0 {
+		return "", errors.New("missing source position")
+	}
+	return string(source[start:end]), nil
+}
+
+// conjuncts flattens a tree of && into it's operands
+func conjuncts(e *expr.Expr) []*expr.Expr {
+	if call := e.GetCallExpr(); call != nil && call.GetFunction() == operators.LogicalAnd {
+		return append(conjuncts(call.GetArgs()[0]), conjuncts(call.GetArgs()[1])...)
+	}
+	return []*expr.Expr{e}
+}
+
+// disjuncts flattens a tree of || into it's operands
+func disjuncts(e *expr.Expr) []*expr.Expr {
+	if call := e.GetCallExpr(); call != nil && call.GetFunction() == operators.LogicalOr {
+		return append(disjuncts(call.GetArgs()[0]), disjuncts(call.GetArgs()[1])...)
+	}
+	return []*expr.Expr{e}
+}
+
+func indexPredicate(e *expr.Expr) (*IndexPredicate, bool) {
+	call := e.GetCallExpr()
+	if call == nil {
+		return nil, false
+	}
+	args := call.GetArgs()
+	switch fn := call.GetFunction(); fn {
+	case operators.LogicalOr:
+		// this.type == 'a' || this.type in ['b', 'c'] is equivalent to this.type in ['a', 'b', 'c']
+		var in *IndexPredicate
+		for _, d := range disjuncts(e) {
+			p, ok := indexPredicate(d)
+			if !ok || (p.Op != IndexEquals && p.Op != IndexIn) || (in != nil && in.Field() != p.Field()) {
+				return nil, false
+			}
+			if in == nil {
+				in = &IndexPredicate{Path: p.Path, Op: IndexIn}
+			}
+			in.Values = append(in.Values, p.Values...)
+		}
+		return in, true
+	case operators.Equals, operators.Less, operators.LessEquals, operators.Greater, operators.GreaterEquals:
+		op := sqlComparisons[fn]
+		lhs, rhs := args[0], args[1]
+		if !isField(lhs) && isField(rhs) {
+			lhs, rhs = rhs, lhs
+			op = flipped[op]
+		}
+		path, ok := fieldPath(lhs)
+		if !ok {
+			return nil, false
+		}
+		value, err := constant(rhs)
+		if err != nil || value == nil {
+			return nil, false
+		}
+		if op == "=" {
+			return &IndexPredicate{Path: path, Op: IndexEquals, Values: []interface{}{value}}, true
+		}
+		switch value.(type) {
+		case int64, uint64, float64:
+		default:
+			return nil, false
+		}
+		p := &IndexPredicate{Path: path, Op: IndexRange}
+		switch op {
+		case "<", "<=":
+			p.Max, p.MaxInclusive = value, op == "<="
+		default:
+			p.Min, p.MinInclusive = value, op == ">="
+		}
+		return p, true
+	case operators.In, operators.OldIn:
+		path, ok := fieldPath(args[0])
+		list := args[1].GetListExpr()
+		if !ok || list == nil {
+			return nil, false
+		}
+		p := &IndexPredicate{Path: path, Op: IndexIn}
+		for _, elem := range list.GetElements() {
+			value, err := constant(elem)
+			if err != nil {
+				return nil, false
+			}
+			p.Values = append(p.Values, value)
+		}
+		return p, true
+	case "startsWith":
+		if call.GetTarget() == nil || len(args) != 1 {
+			return nil, false
+		}
+		path, ok := fieldPath(call.GetTarget())
+		if !ok {
+			return nil, false
+		}
+		value, err := constant(args[0])
+		if _, isStr := value.(string); err != nil || !isStr {
+			return nil, false
+		}
+		return &IndexPredicate{Path: path, Op: IndexPrefix, Values: []interface{}{value}}, true
+	}
+	return nil, false
+}
+
+// mergeRange narrows the bounds of range to include the bounds of other
+func mergeRange(r *IndexPredicate, other *IndexPredicate) {
+	if other.Min != nil {
+		if r.Min == nil || compareNumbers(other.Min, r.Min) > 0 || (compareNumbers(other.Min, r.Min) == 0 && !other.MinInclusive) {
+			r.Min, r.MinInclusive = other.Min, other.MinInclusive
+		}
+	}
+	if other.Max != nil {
+		if r.Max == nil || compareNumbers(other.Max, r.Max) < 0 || (compareNumbers(other.Max, r.Max) == 0 && !other.MaxInclusive) {
+			r.Max, r.MaxInclusive = other.Max, other.MaxInclusive
+		}
+	}
+}
+
+func compareNumbers(a, b interface{}) int {
+	af, bf := toFloat(a), toFloat(b)
+	switch {
+	case af < bf:
+		return -1
+	case af > bf:
+		return 1
+	}
+	return 0
+}
+
+func toFloat(v interface{}) float64 {
+	switch n := v.(type) {
+	case int64:
+		return float64(n)
+	case uint64:
+		return float64(n)
+	case float64:
+		return n
+	}
+	return 0
+}
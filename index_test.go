@@ -0,0 +1,117 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"testing"
+)
+
+func TestDecision_QueryPlan(t *testing.T) {
+	decision, err := trigger.NewDecision(`this.type == 'user' && this.age >= 18 && 65 > this.age &&
+	(this.role == 'admin' || this.role in ['owner']) && this.email.startsWith('bob') &&
+	[this.first, this.last].exists(n, n.sha1() == 'x')`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	plan, err := decision.QueryPlan()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var got []string
+	for _, p := range plan.Predicates {
+		got = append(got, p.String())
+	}
+	want := []string{
+		"this.type equals [user]",
+		"this.age range [18, 65)",
+		"this.role in [admin owner]",
+		"this.email prefix [bob]",
+	}
+	if len(got) != len(want) {
+		t.Fatalf("QueryPlan() predicates = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("QueryPlan() predicates = %v, want %v", got, want)
+		}
+	}
+	if plan.Residual == nil || plan.Residual.Expression() != "[this.first, this.last].exists(n, n.sha1() == 'x')" {
+		t.Fatalf("unexpected residual: %v", plan.Residual)
+	}
+	if err := plan.Residual.Eval(map[string]interface{}{
+		"first": "bob",
+		"last":  "smith",
+	}); err != trigger.ErrDecisionDenied {
+		t.Fatalf("expected residual to be denied, got %v", err)
+	}
+	exact, err := trigger.NewDecision("this.type == 'user'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	plan, err = exact.QueryPlan()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if plan.Residual != nil || len(plan.Predicates) != 1 {
+		t.Fatalf("expected a single exact predicate, got %v %v", plan.Predicates, plan.Residual)
+	}
+}
+
+func TestDecision_QueryPlan_Residual(t *testing.T) {
+	type testCase struct {
+		name       string
+		expression string
+		data       map[string]interface{}
+		allowed    bool
+	}
+	var testCases = []testCase{
+		{
+			name:       "raw string",
+			expression: `this.name.endsWith(r'x') && this.a == 1`,
+			data:       map[string]interface{}{"name": "box", "a": 1},
+			allowed:    true,
+		},
+		{
+			name:       "triple quoted string",
+			expression: `this.a == 1 && this.name.endsWith("""x""")`,
+			data:       map[string]interface{}{"name": "bob", "a": 1},
+			allowed:    false,
+		},
+		{
+			name:       "several residuals",
+			expression: `this.name.endsWith(r'\d') && this.a == 1 && (this.b > 1 || this.name.contains('''"'''))`,
+			data:       map[string]interface{}{"name": `"\d`, "a": 1, "b": 0},
+			allowed:    true,
+		},
+		{
+			name:       "comprehension",
+			expression: `this.a == 1 && [this.name].exists(n, n.endsWith(r'x') || n.endsWith("""y"""))`,
+			data:       map[string]interface{}{"name": "boy", "a": 1},
+			allowed:    true,
+		},
+	}
+	for _, tt := range testCases {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := trigger.NewDecision(tt.expression)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			plan, err := decision.QueryPlan()
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if len(plan.Predicates) != 1 || plan.Predicates[0].String() != "this.a equals [1]" {
+				t.Fatalf("QueryPlan() predicates = %v", plan.Predicates)
+			}
+			if plan.Residual == nil {
+				t.Fatal("expected a residual decision")
+			}
+			err = plan.Residual.Eval(tt.data)
+			if tt.allowed && err != nil {
+				t.Fatalf("expected residual (%s) to allow, got %v", plan.Residual.Expression(), err)
+			}
+			if !tt.allowed && err != trigger.ErrDecisionDenied {
+				t.Fatalf("expected residual (%s) to be denied, got %v", plan.Residual.Expression(), err)
+			}
+		})
+	}
+}
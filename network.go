@@ -0,0 +1,388 @@
+package trigger
+
+import (
+	"context"
+	"fmt"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/pkg/errors"
+	"reflect"
+	"strings"
+)
+
+// RuleNetwork matches documents against many triggers at once. Like a Rete network, the decision of each trigger is
+// split into simple field conditions (see Decision.QueryPlan) & a residual. Conditions shared by multiple triggers,
+// ex: this.event == 'signup', are evaluated at most once per document & triggers are indexed by the field values
+// they require so only triggers whose discriminating conditions match are considered.
+type RuleNetwork struct {
+	triggers []*Trigger
+	rules    []*networkRule
+	// alphas are the distinct field conditions of every trigger
+	alphas []*IndexPredicate
+	// indexes hold the triggers that require a field to equal one of a set of values
+	indexes []*fieldIndex
+	// unindexed holds the triggers that must be considered for every document
+	unindexed []int
+}
+
+type networkRule struct {
+	alphas   []int
+	residual *Decision
+	// fallback is true if the trigger's decision couldn't be planned & must be evaluated as a whole
+	fallback bool
+	// strict is true if the trigger's DecisionErrorPolicy is DecisionErrorFail. A missing field or a value of another
+	// type makes CEL fail rather than deny, so the trigger's decision is evaluated as a whole to report the error.
+	strict bool
+	// discriminator is the alpha the trigger is indexed by
+	discriminator int
+}
+
+type fieldIndex struct {
+	path  []string
+	rules map[string][]int
+	// strict holds the indexed triggers whose DecisionErrorPolicy is DecisionErrorFail
+	strict []int
+}
+
+// NewRuleNetwork compiles the decisions of the triggers into a RuleNetwork
+func NewRuleNetwork(triggers []*Trigger) (*RuleNetwork, error) {
+	n := &RuleNetwork{
+		triggers: triggers,
+	}
+	alphas := map[string]int{}
+	indexes := map[string]*fieldIndex{}
+	for i, t := range triggers {
+		if t.decision == nil {
+			return nil, errors.Errorf("trigger: trigger %v has no decision", i)
+		}
+		rule := &networkRule{
+			strict: t.onDecisionError == DecisionErrorFail,
+		}
+		n.rules = append(n.rules, rule)
+		plan, err := t.decision.QueryPlan()
+		if err != nil || !nativePlan(plan) {
+			rule.fallback = true
+			n.unindexed = append(n.unindexed, i)
+			continue
+		}
+		rule.residual = plan.Residual
+		var discriminator *IndexPredicate
+		for _, p := range plan.Predicates {
+			key := p.String()
+			alpha, ok := alphas[key]
+			if !ok {
+				alpha = len(n.alphas)
+				alphas[key] = alpha
+				n.alphas = append(n.alphas, p)
+			}
+			rule.alphas = append(rule.alphas, alpha)
+			if discriminator == nil && (p.Op == IndexEquals || p.Op == IndexIn) {
+				discriminator = p
+				rule.discriminator = alpha
+			}
+		}
+		if discriminator == nil {
+			n.unindexed = append(n.unindexed, i)
+			continue
+		}
+		index, ok := indexes[discriminator.Field()]
+		if !ok {
+			index = &fieldIndex{
+				path:  discriminator.Path[1:],
+				rules: map[string][]int{},
+			}
+			indexes[discriminator.Field()] = index
+			n.indexes = append(n.indexes, index)
+		}
+		for _, value := range discriminator.Values {
+			key := indexKey(value)
+			index.rules[key] = append(index.rules[key], i)
+		}
+		if rule.strict {
+			index.strict = append(index.strict, i)
+		}
+	}
+	return n, nil
+}
+
+// nativePlan returns true if every predicate of the plan can be evaluated directly against the Mapper
+func nativePlan(plan *QueryPlan) bool {
+	for _, p := range plan.Predicates {
+		if len(p.Path) < 2 || p.Path[0] != "this" {
+			return false
+		}
+	}
+	return true
+}
+
+// Match returns the indexes of the triggers whose decisions allow, in order. A decision that fails to evaluate is
+// handled by it's trigger's DecisionErrorPolicy, as it is by Trigger.
+func (n *RuleNetwork) Match(data map[string]interface{}) ([]int, error) {
+	return n.MatchContext(context.Background(), data)
+}
+
+// MatchContext is like Match but evaluation is stopped once the context is done
+func (n *RuleNetwork) MatchContext(ctx context.Context, data map[string]interface{}) ([]int, error) {
+	candidates := make([]bool, len(n.rules))
+	alphas := make([]alphaResult, len(n.alphas))
+	for _, i := range n.unindexed {
+		candidates[i] = true
+	}
+	for _, index := range n.indexes {
+		value, found, ok := lookupPath(data, index.path)
+		if !ok {
+			// the field can't be resolved natively so every trigger of the index is a candidate
+			for _, rules := range index.rules {
+				for _, i := range rules {
+					candidates[i] = true
+				}
+			}
+			continue
+		}
+		if found {
+			for _, i := range index.rules[indexKey(value)] {
+				candidates[i] = true
+			}
+		}
+		// strict triggers are candidates if their discriminating field is missing or of another type
+		for _, i := range index.strict {
+			if n.alpha(n.rules[i].discriminator, alphas, data) == alphaMismatch {
+				candidates[i] = true
+			}
+		}
+	}
+	var matches []int
+	for i, candidate := range candidates {
+		if !candidate {
+			continue
+		}
+		rule := n.rules[i]
+		fallback := rule.fallback
+		if !fallback {
+			matched, unsupported := n.alphasMatch(rule, alphas, data)
+			if !matched && !unsupported {
+				continue
+			}
+			fallback = unsupported
+		}
+		decision := rule.residual
+		if fallback {
+			decision = n.triggers[i].decision
+		}
+		if decision != nil {
+			if err := ctx.Err(); err != nil {
+				return nil, errors.Wrap(err, "trigger: failed to match rule network")
+			}
+			allowed, err := evaluate(decision, data)
+			if err != nil && n.triggers[i].escalate(ctx, err) {
+				return nil, errors.Wrapf(err, "trigger: failed to match trigger %v", i)
+			}
+			if !allowed {
+				continue
+			}
+		}
+		matches = append(matches, i)
+	}
+	return matches, nil
+}
+
+type alphaResult int
+
+const (
+	alphaUnknown alphaResult = iota
+	alphaTrue
+	alphaFalse
+	// alphaUnsupported means the condition must be evaluated by the rule's decision
+	alphaUnsupported
+	// alphaMismatch means the field is missing or of another type. The condition doesn't hold, but CEL fails to
+	// evaluate it rather than deny.
+	alphaMismatch
+)
+
+// alpha returns the result of a field condition, evaluating it once per document
+func (n *RuleNetwork) alpha(alpha int, alphas []alphaResult, data map[string]interface{}) alphaResult {
+	if alphas[alpha] == alphaUnknown {
+		alphas[alpha] = evalAlpha(n.alphas[alpha], data)
+	}
+	return alphas[alpha]
+}
+
+// alphasMatch evaluates the rule's field conditions, sharing results between rules. unsupported is true if a
+// condition can't be evaluated natively & the rule's original decision must be evaluated instead. A false condition
+// denies the rule even if another condition fails to evaluate, like CEL's &&.
+func (n *RuleNetwork) alphasMatch(rule *networkRule, alphas []alphaResult, data map[string]interface{}) (matched bool, unsupported bool) {
+	var mismatch bool
+	for _, alpha := range rule.alphas {
+		switch n.alpha(alpha, alphas, data) {
+		case alphaFalse:
+			return false, false
+		case alphaUnsupported:
+			unsupported = true
+		case alphaMismatch:
+			mismatch = true
+		}
+	}
+	if unsupported {
+		return false, true
+	}
+	if mismatch {
+		// the rule's decision can't allow, but a strict rule's decision is evaluated to return it's error
+		return false, rule.strict
+	}
+	return true, false
+}
+
+// evalAlpha evaluates a field condition against the Mapper with CEL's semantics: values of different types are
+// never equal or ordered.
+func evalAlpha(p *IndexPredicate, data map[string]interface{}) alphaResult {
+	value, found, ok := lookupPath(data, p.Path[1:])
+	if !ok {
+		return alphaUnsupported
+	}
+	if !found {
+		return alphaMismatch
+	}
+	value = normalize(value)
+	result, comparable := false, true
+	switch p.Op {
+	case IndexEquals, IndexIn:
+		key := indexKey(value)
+		for _, v := range p.Values {
+			if indexKey(v) == key {
+				result = true
+				break
+			}
+			if reflect.TypeOf(normalize(v)) != reflect.TypeOf(value) {
+				comparable = false
+			}
+		}
+	case IndexPrefix:
+		str, isStr := value.(string)
+		result = isStr && strings.HasPrefix(str, p.Values[0].(string))
+		comparable = isStr
+	case IndexRange:
+		result = true
+		if p.Min != nil {
+			var cmp int
+			cmp, comparable = compareSameType(value, p.Min)
+			result = comparable && (cmp > 0 || (cmp == 0 && p.MinInclusive))
+		}
+		if comparable && p.Max != nil {
+			var cmp int
+			cmp, comparable = compareSameType(value, p.Max)
+			result = result && comparable && (cmp < 0 || (cmp == 0 && p.MaxInclusive))
+		}
+	}
+	switch {
+	case result:
+		return alphaTrue
+	case !comparable:
+		return alphaMismatch
+	}
+	return alphaFalse
+}
+
+func compareSameType(a, b interface{}) (int, bool) {
+	if reflect.TypeOf(a) != reflect.TypeOf(b) {
+		return 0, false
+	}
+	return compareNumbers(a, b), true
+}
+
+// lookupPath returns the value of the field path within the Mapper. ok is false if the path passes through a value
+// that isn't a map with string keys.
+func lookupPath(data map[string]interface{}, path []string) (value interface{}, found bool, ok bool) {
+	var current interface{} = data
+	for _, field := range path {
+		switch m := current.(type) {
+		case map[string]interface{}:
+			current, found = m[field]
+		default:
+			rv := reflect.ValueOf(current)
+			if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+				return nil, false, false
+			}
+			v := rv.MapIndex(reflect.ValueOf(field).Convert(rv.Type().Key()))
+			found = v.IsValid()
+			if found {
+				current = v.Interface()
+			}
+		}
+		if !found {
+			return nil, false, true
+		}
+	}
+	return current, true, true
+}
+
+// normalize converts Go numbers to the int64, uint64 & float64 values CEL operates on
+func normalize(value interface{}) interface{} {
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float()
+	case reflect.String:
+		return rv.String()
+	case reflect.Bool:
+		return rv.Bool()
+	}
+	return value
+}
+
+// indexKey returns a comparable key for a value that includes it's type so values of different types never collide
+func indexKey(value interface{}) string {
+	value = normalize(value)
+	return fmt.Sprintf("%T:%v", value, value)
+}
+
+// Trigger executes the mutation of every matching trigger & the else mutation of every other trigger that has one
+// against the Mapper & merges their patches in order
+func (n *RuleNetwork) Trigger(data map[string]interface{}) (map[string]interface{}, error) {
+	return n.TriggerContext(context.Background(), data)
+}
+
+// TriggerContext is like Trigger but evaluation is stopped once the context is done
+func (n *RuleNetwork) TriggerContext(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	matches, err := n.MatchContext(ctx, data)
+	if err != nil {
+		return nil, err
+	}
+	matched := map[int]bool{}
+	for _, i := range matches {
+		matched[i] = true
+	}
+	patch := map[string]interface{}{}
+	for i, t := range n.triggers {
+		var out ref.Val
+		switch {
+		case matched[i]:
+			vars, err := t.env.vars(map[string]interface{}{
+				"this": data,
+			})
+			if err != nil {
+				return nil, err
+			}
+			if out, err = t.mutate(ctx, vars); err != nil {
+				return nil, err
+			}
+		case t.otherwise != nil:
+			// the trigger didn't match because it's decision denied or failed to evaluate. the trigger is executed
+			// as a whole to tell them apart.
+			if out, err = t.eval(ctx, map[string]interface{}{
+				"this": data,
+			}); err != nil {
+				return nil, err
+			}
+		}
+		if out == nil {
+			continue
+		}
+		for k, v := range toPatch(out) {
+			patch[k] = v
+		}
+	}
+	return patch, nil
+}
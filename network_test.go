@@ -0,0 +1,152 @@
+package trigger_test
+
+import (
+	"fmt"
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+func TestRuleNetwork_Match(t *testing.T) {
+	expressions := []string{
+		"this.event == 'signup' && this.plan == 'pro' => {'welcome': 'pro'}",
+		"this.event == 'signup' => {'welcome': 'basic'}",
+		"this.event in ['login', 'logout'] && this.attempts > 3 => {'locked': true}",
+		"this.email.startsWith('admin@') && this.email.endsWith('.com') => {'admin': true}",
+		"this.event == 'signup' && size(this.email) > 5 => {'valid': true}",
+		"this.address.city == 'denver' => {'local': true}",
+		"this.attempts > 2 || this.event == 'reset' => {'notify': true}",
+	}
+	var triggers []*trigger.Trigger
+	for _, expression := range expressions {
+		tr, err := trigger.NewArrowTrigger(expression)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		triggers = append(triggers, tr)
+	}
+	network, err := trigger.NewRuleNetwork(triggers)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	docs := []map[string]interface{}{
+		{"event": "signup", "plan": "pro", "email": "admin@acme.com"},
+		{"event": "signup", "plan": "free", "email": "a@b"},
+		{"event": "login", "attempts": 5},
+		{"event": "logout", "attempts": 5.0},
+		{"event": "reset", "address": map[string]interface{}{"city": "denver"}},
+		{"event": "reset", "address": map[string]string{"city": "denver"}},
+		{"event": 1, "attempts": int32(3)},
+		{},
+	}
+	for i, doc := range docs {
+		var want []int
+		for j, tr := range triggers {
+			if err := tr.Decision().Eval(doc); err == nil {
+				want = append(want, j)
+			}
+		}
+		got, err := network.Match(doc)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("document %v: expected %v, got: %v", i, want, got)
+		}
+	}
+	patch, err := network.Trigger(docs[0])
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	want := map[string]interface{}{"welcome": "basic", "admin": true, "valid": true}
+	if !reflect.DeepEqual(patch, want) {
+		t.Fatalf("expected %v, got: %v", want, patch)
+	}
+	// with DecisionErrorFail the network fails on the first decision that fails to evaluate, like the trigger does
+	var strict []*trigger.Trigger
+	for _, tr := range triggers {
+		strict = append(strict, tr.WithDecisionErrorPolicy(trigger.DecisionErrorFail))
+	}
+	network, err = trigger.NewRuleNetwork(strict)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	docs = append(docs, map[string]interface{}{"other": 1}, map[string]interface{}{"event": "signup", "plan": 1})
+	for i, doc := range docs {
+		var want []int
+		var wantErr error
+		for j, tr := range strict {
+			if _, err := tr.Trigger(doc); err != nil {
+				wantErr = err
+				break
+			}
+			if err := tr.Decision().Eval(doc); err == nil {
+				want = append(want, j)
+			}
+		}
+		got, err := network.Match(doc)
+		if (err != nil) != (wantErr != nil) {
+			t.Fatalf("document %v: expected error %v, got: %v", i, wantErr, err)
+		}
+		if err != nil {
+			if errors.Cause(err).Error() != errors.Cause(wantErr).Error() {
+				t.Fatalf("document %v: expected error %v, got: %v", i, wantErr, err)
+			}
+			if _, err := network.Trigger(doc); err == nil {
+				t.Fatalf("document %v: expected Trigger to fail", i)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("document %v: expected %v, got: %v", i, want, got)
+		}
+	}
+}
+
+func benchmarkTriggers(b *testing.B, count int) []*trigger.Trigger {
+	var triggers []*trigger.Trigger
+	for i := 0; i < count; i++ {
+		tr, err := trigger.NewArrowTrigger(fmt.Sprintf("this.event == 'event-%v' && this.count > %v => {'rule': %v}", i%100, i%10, i))
+		if err != nil {
+			b.Fatal(err.Error())
+		}
+		triggers = append(triggers, tr)
+	}
+	return triggers
+}
+
+var benchmarkDoc = map[string]interface{}{
+	"event": "event-42",
+	"count": 5,
+}
+
+func BenchmarkRuleNetwork_Trigger(b *testing.B) {
+	network, err := trigger.NewRuleNetwork(benchmarkTriggers(b, 1000))
+	if err != nil {
+		b.Fatal(err.Error())
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := network.Trigger(benchmarkDoc); err != nil {
+			b.Fatal(err.Error())
+		}
+	}
+}
+
+func BenchmarkNaive_Trigger(b *testing.B) {
+	triggers := benchmarkTriggers(b, 1000)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		patch := map[string]interface{}{}
+		for _, tr := range triggers {
+			out, err := tr.Trigger(benchmarkDoc)
+			if err != nil {
+				b.Fatal(err.Error())
+			}
+			for k, v := range out {
+				patch[k] = v
+			}
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package trigger
+
+import (
+	"context"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/interpreter"
+	"github.com/pkg/errors"
+	"strings"
+)
+
+// PartialDecision is the result of evaluating a Decision against partially known input
+type PartialDecision struct {
+	// Residual is the remainder of the decision over the unknown attributes. It is nil if the decision could be
+	// determined from the known input alone.
+	Residual *Decision
+	// Allowed is the outcome of the decision if Residual is nil
+	Allowed bool
+}
+
+// PartialEval evaluates the decision against the known Mapper. unknownPaths are dot separated attribute paths
+// (ex: this.document, this.document.owner) whose values are not yet known; a path segment of * matches any field.
+// If the outcome depends on an unknown attribute, a residual Decision over the unknown attributes is returned.
+// The Env's Limits apply to the evaluation of the known attributes.
+func (n *Decision) PartialEval(knownData map[string]interface{}, unknownPaths ...string) (*PartialDecision, error) {
+	return n.PartialEvalVars(map[string]interface{}{
+		"this": knownData,
+	}, unknownPaths...)
+}
+
+// PartialEvalVars is like PartialEval but evaluates the decision against the named input variables declared in the Env
+func (n *Decision) PartialEvalVars(vars map[string]interface{}, unknownPaths ...string) (*PartialDecision, error) {
+	n.partialOnce.Do(func() {
+		n.env.mu.RLock()
+		defer n.env.mu.RUnlock()
+		n.partialProgram, n.partialErr = n.env.program(n.ast, cel.EvalOptions(cel.OptPartialEval, cel.OptTrackState))
+	})
+	if n.partialErr != nil {
+		return nil, errors.Wrapf(n.partialErr, "trigger: failed to partially evaluate decision (%s)", n.expression)
+	}
+	vars, err := n.env.vars(vars)
+	if err != nil {
+		return nil, err
+	}
+	var patterns []*interpreter.AttributePattern
+	for _, path := range unknownPaths {
+		patterns = append(patterns, attributePattern(path))
+	}
+	ctrl := newControl(context.Background(), n.env.limits)
+	activation, err := cel.PartialVars(ctrl.activation(vars), patterns...)
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to partially evaluate decision (%s)", n.expression)
+	}
+	out, details, err := n.partialProgram.Eval(activation)
+	if ctrlErr := ctrl.err(); ctrlErr != nil {
+		return nil, errors.Wrapf(ctrlErr, "trigger: failed to partially evaluate decision (%s)", n.expression)
+	}
+	if out != nil && types.IsUnknown(out) {
+		n.env.mu.RLock()
+		residual, err := n.env.env.ResidualAst(n.ast, details)
+		n.env.mu.RUnlock()
+		if err != nil {
+			return nil, errors.Wrapf(err, "trigger: failed to create residual decision (%s)", n.expression)
+		}
+		expression, err := cel.AstToString(residual)
+		if err != nil {
+			return nil, errors.Wrapf(err, "trigger: failed to create residual decision (%s)", n.expression)
+		}
+		decision, err := n.env.NewDecision(expression)
+		if err != nil {
+			return nil, errors.Wrapf(err, "trigger: failed to create residual decision (%s)", n.expression)
+		}
+		return &PartialDecision{
+			Residual: decision,
+		}, nil
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to partially evaluate decision (%s)", n.expression)
+	}
+	val, ok := out.Value().(bool)
+	return &PartialDecision{
+		Allowed: ok && val,
+	}, nil
+}
+
+func attributePattern(path string) *interpreter.AttributePattern {
+	segments := strings.Split(path, ".")
+	pattern := cel.AttributePattern(segments[0])
+	for _, segment := range segments[1:] {
+		if segment == "*" {
+			pattern = pattern.Wildcard()
+		} else {
+			pattern = pattern.QualString(segment)
+		}
+	}
+	return pattern
+}
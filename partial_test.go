@@ -0,0 +1,105 @@
+package trigger_test
+
+import (
+	"github.com/google/cel-go/checker/decls"
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"testing"
+)
+
+func TestDecision_PartialEval(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("user", decls.NewMapType(decls.String, decls.Dyn)),
+		trigger.WithVariable("doc", decls.NewMapType(decls.String, decls.Dyn)),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("user.role == 'admin' || (user.verified && doc.owner == user.id)")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err := decision.PartialEvalVars(map[string]interface{}{
+		"user": map[string]interface{}{"role": "admin", "verified": true, "id": "1"},
+	}, "doc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Residual != nil || !result.Allowed {
+		t.Fatal("expected decision to be allowed without knowing the document")
+	}
+	result, err = decision.PartialEvalVars(map[string]interface{}{
+		"user": map[string]interface{}{"role": "viewer", "verified": false, "id": "1"},
+	}, "doc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Residual != nil || result.Allowed {
+		t.Fatal("expected decision to be denied without knowing the document")
+	}
+	result, err = decision.PartialEvalVars(map[string]interface{}{
+		"user": map[string]interface{}{"role": "viewer", "verified": true, "id": "1"},
+	}, "doc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Residual == nil {
+		t.Fatal("expected a residual decision")
+	}
+	t.Log(result.Residual.Expression())
+	if err := result.Residual.EvalVars(map[string]interface{}{
+		"doc": map[string]interface{}{"owner": "1"},
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := result.Residual.EvalVars(map[string]interface{}{
+		"doc": map[string]interface{}{"owner": "2"},
+	}); err != trigger.ErrDecisionDenied {
+		t.Fatalf("expected residual to be denied, got %v", err)
+	}
+	thisDecision, err := trigger.NewDecision("this.user.email.endsWith('acme.com') && this.doc.public")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err = thisDecision.PartialEval(map[string]interface{}{
+		"user": map[string]interface{}{"email": "bob@acme.com"},
+	}, "this.doc")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Residual == nil || result.Residual.Expression() != "this.doc.public" {
+		t.Fatalf("unexpected residual: %v", result.Residual)
+	}
+}
+
+func TestDecision_PartialEval_Limits(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("this", decls.NewMapType(decls.String, decls.Dyn)),
+		trigger.WithLimits(trigger.Limits{MaxIterations: 5}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("this.items.all(i, i > 0) && this.owner == 'bob'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var items []interface{}
+	for i := 1; i <= 100; i++ {
+		items = append(items, i)
+	}
+	if _, err := decision.PartialEval(map[string]interface{}{
+		"items": items,
+	}, "this.owner"); errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got: %v", err)
+	}
+	partial, err := decision.PartialEval(map[string]interface{}{
+		"items": items[:3],
+	}, "this.owner")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if partial.Residual == nil {
+		t.Fatal("expected a residual decision")
+	}
+}
@@ -0,0 +1,79 @@
+package trigger
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// Stage records the outcome of a single trigger of a Pipeline
+type Stage struct {
+	// Index is the position of the trigger in the pipeline
+	Index int
+	// Trigger is the trigger that was executed
+	Trigger *Trigger
+	// Fired is true if the trigger's decision allowed
+	Fired bool
+	// Else is true if the trigger's decision denied & it's else mutation was executed
+	Else bool
+	// Patch holds the fields the trigger set. It is empty if neither of the trigger's mutations was executed.
+	Patch map[string]interface{}
+}
+
+// PipelineResult is the outcome of running a Pipeline
+type PipelineResult struct {
+	// Data is the input merged with the patch of every executed mutation
+	Data map[string]interface{}
+	// Stages records the outcome of each trigger in order
+	Stages []*Stage
+}
+
+// Pipeline executes an ordered list of triggers. Each trigger is executed against the input merged with the
+// patches of the triggers before it.
+type Pipeline struct {
+	triggers []*Trigger
+}
+
+// NewPipeline creates a Pipeline that executes the triggers in order
+func NewPipeline(triggers ...*Trigger) *Pipeline {
+	return &Pipeline{
+		triggers: triggers,
+	}
+}
+
+// Run executes the pipeline's triggers against the Mapper. The Mapper is not modified.
+func (p *Pipeline) Run(data map[string]interface{}) (*PipelineResult, error) {
+	return p.RunContext(context.Background(), data)
+}
+
+// RunContext is like Run but evaluation is stopped once the context is done
+func (p *Pipeline) RunContext(ctx context.Context, data map[string]interface{}) (*PipelineResult, error) {
+	result := &PipelineResult{
+		Data: map[string]interface{}{},
+	}
+	for k, v := range data {
+		result.Data[k] = v
+	}
+	for i, t := range p.triggers {
+		fired, out, err := t.fire(ctx, map[string]interface{}{
+			"this": result.Data,
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "trigger: pipeline stage %v failed", i)
+		}
+		stage := &Stage{
+			Index:   i,
+			Trigger: t,
+			Fired:   fired.Fired,
+			Else:    fired.Else,
+			Patch:   map[string]interface{}{},
+		}
+		if out != nil {
+			stage.Patch = toPatch(out)
+			for k, v := range stage.Patch {
+				result.Data[k] = v
+			}
+		}
+		result.Stages = append(result.Stages, stage)
+	}
+	return result, nil
+}
@@ -0,0 +1,92 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"reflect"
+	"testing"
+)
+
+// mustTrigger creates a Trigger from the arrow expression or fails the test
+func mustTrigger(t *testing.T, arrowExpression string) *trigger.Trigger {
+	t.Helper()
+	tr, err := trigger.NewArrowTrigger(arrowExpression)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return tr
+}
+
+func TestPipeline_Run(t *testing.T) {
+	pipeline := trigger.NewPipeline(
+		mustTrigger(t, "has(this.title) => {'slug': this.title.lowerCase().replace(' ', '-')}"),
+		mustTrigger(t, "has(this.slug) => {'url': '/posts/' + this.slug}"),
+		mustTrigger(t, "has(this.draft) => {'published': false}"),
+	)
+	input := map[string]interface{}{
+		"title": "Hello World",
+	}
+	result, err := pipeline.Run(input)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	want := map[string]interface{}{
+		"title": "Hello World",
+		"slug":  "hello-world",
+		"url":   "/posts/hello-world",
+	}
+	if !reflect.DeepEqual(result.Data, want) {
+		t.Fatalf("expected %v, got: %v", want, result.Data)
+	}
+	if len(input) != 1 {
+		t.Fatalf("expected input to be unmodified, got: %v", input)
+	}
+	var fired []bool
+	for _, stage := range result.Stages {
+		fired = append(fired, stage.Fired)
+	}
+	if !reflect.DeepEqual(fired, []bool{true, true, false}) {
+		t.Fatalf("unexpected stages: %v", fired)
+	}
+	if result.Stages[1].Patch["url"] != "/posts/hello-world" {
+		t.Fatalf("unexpected patch: %v", result.Stages[1].Patch)
+	}
+}
+
+func TestPipeline_Run_Else(t *testing.T) {
+	set, err := trigger.ParseRules(`rule "r" when this.status == 'new' then {'status': 'processed'} else {'status': 'ignored'}`)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tests := []struct {
+		status string
+		want   string
+		isElse bool
+	}{
+		{status: "new", want: "processed"},
+		{status: "old", want: "ignored", isElse: true},
+	}
+	network, err := trigger.NewRuleNetwork(set.Triggers())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, tt := range tests {
+		data := map[string]interface{}{"status": tt.status}
+		result, err := trigger.NewPipeline(set.Triggers()...).Run(data)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result.Data["status"] != tt.want || len(result.Stages) != 1 {
+			t.Fatalf("expected a single stage with status %s, got: %v", tt.want, result.Data)
+		}
+		if stage := result.Stages[0]; stage.Fired == tt.isElse || stage.Else != tt.isElse {
+			t.Fatalf("expected fired = %v & else = %v, got: %v %v", !tt.isElse, tt.isElse, stage.Fired, stage.Else)
+		}
+		patch, err := network.Trigger(data)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if patch["status"] != tt.want {
+			t.Fatalf("expected the network to patch status %s, got: %v", tt.want, patch)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package trigger
+
+import (
+	"github.com/pkg/errors"
+)
+
+// Effect is the outcome of a policy rule
+type Effect int
+
+const (
+	// Forbid denies access
+	Forbid Effect = iota
+	// Permit allows access
+	Permit
+)
+
+// String returns the name of the effect
+func (e Effect) String() string {
+	if e == Permit {
+		return "permit"
+	}
+	return "forbid"
+}
+
+// CombiningAlgorithm determines the effect of a Policy when multiple rules match
+type CombiningAlgorithm int
+
+const (
+	// DenyOverrides forbids if any forbid rule matches, otherwise permits if any permit rule matches
+	DenyOverrides CombiningAlgorithm = iota
+	// PermitOverrides permits if any permit rule matches, otherwise forbids if any forbid rule matches
+	PermitOverrides
+	// FirstMatch applies the effect of the first matching rule
+	FirstMatch
+)
+
+// Rule is a named permit or forbid rule of a Policy
+type Rule struct {
+	// ID identifies the rule within the policy
+	ID string
+	// Effect is applied if the rule matches
+	Effect Effect
+	// Target optionally restricts the inputs the rule applies to
+	Target Evaluator
+	// Condition must allow for the rule to match
+	Condition Evaluator
+}
+
+// NewRule creates a Rule from a condition expression & an optional target expression
+func (e *Env) NewRule(id string, effect Effect, target, condition string) (*Rule, error) {
+	rule := &Rule{
+		ID:     id,
+		Effect: effect,
+	}
+	if target != "" {
+		decision, err := e.NewDecision(target)
+		if err != nil {
+			return nil, errors.Wrapf(err, "trigger: failed to create rule target (%s)", id)
+		}
+		rule.Target = decision
+	}
+	decision, err := e.NewDecision(condition)
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to create rule condition (%s)", id)
+	}
+	rule.Condition = decision
+	return rule, nil
+}
+
+// NewRule creates a Rule from a condition expression & an optional target expression using the default Env
+func NewRule(id string, effect Effect, target, condition string) (*Rule, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewRule(id, effect, target, condition)
+}
+
+// matches returns true if the rule's target & condition allow
+func (r *Rule) matches(data map[string]interface{}) (bool, error) {
+	if r.Target != nil {
+		applies, err := evaluate(r.Target, data)
+		if err != nil {
+			return false, errors.Wrapf(err, "trigger: failed to evaluate rule target (%s)", r.ID)
+		}
+		if !applies {
+			return false, nil
+		}
+	}
+	matches, err := evaluate(r.Condition, data)
+	if err != nil {
+		return false, errors.Wrapf(err, "trigger: failed to evaluate rule condition (%s)", r.ID)
+	}
+	return matches, nil
+}
+
+// Authorization is the outcome of a Policy
+type Authorization struct {
+	// Effect is the policy's outcome
+	Effect Effect
+	// Rules are the IDs of the matching rules that determined the effect
+	Rules []string
+	// Default is true if no rule matched & the effect is the policy's default of Forbid
+	Default bool
+}
+
+// Policy is a set of permit & forbid rules combined by a CombiningAlgorithm. A Policy forbids if no rule matches.
+type Policy struct {
+	algorithm CombiningAlgorithm
+	rules     []*Rule
+}
+
+// NewPolicy creates a Policy from the rules. The rules are evaluated in order.
+func NewPolicy(algorithm CombiningAlgorithm, rules ...*Rule) (*Policy, error) {
+	ids := map[string]bool{}
+	for _, rule := range rules {
+		if rule.Condition == nil {
+			return nil, errors.Errorf("trigger: rule %s has no condition", rule.ID)
+		}
+		if ids[rule.ID] {
+			return nil, errors.Errorf("trigger: duplicate rule %s", rule.ID)
+		}
+		ids[rule.ID] = true
+	}
+	return &Policy{
+		algorithm: algorithm,
+		rules:     rules,
+	}, nil
+}
+
+// Authorize evaluates the policy's rules against the Mapper
+func (p *Policy) Authorize(data map[string]interface{}) (*Authorization, error) {
+	var permits, forbids []string
+	for _, rule := range p.rules {
+		matches, err := rule.matches(data)
+		if err != nil {
+			return nil, err
+		}
+		if !matches {
+			continue
+		}
+		switch {
+		case p.algorithm == FirstMatch:
+			return &Authorization{
+				Effect: rule.Effect,
+				Rules:  []string{rule.ID},
+			}, nil
+		case rule.Effect == Permit:
+			permits = append(permits, rule.ID)
+		default:
+			forbids = append(forbids, rule.ID)
+		}
+	}
+	switch {
+	case len(forbids) > 0 && (p.algorithm == DenyOverrides || len(permits) == 0):
+		return &Authorization{
+			Effect: Forbid,
+			Rules:  forbids,
+		}, nil
+	case len(permits) > 0:
+		return &Authorization{
+			Effect: Permit,
+			Rules:  permits,
+		}, nil
+	}
+	return &Authorization{
+		Effect:  Forbid,
+		Default: true,
+	}, nil
+}
+
+// Eval implements Evaluator. It returns ErrDecisionDenied unless the policy permits.
+func (p *Policy) Eval(data map[string]interface{}) error {
+	authorization, err := p.Authorize(data)
+	if err != nil {
+		return err
+	}
+	if authorization.Effect != Permit {
+		return ErrDecisionDenied
+	}
+	return nil
+}
@@ -0,0 +1,68 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"reflect"
+	"testing"
+)
+
+func TestPolicy_Authorize(t *testing.T) {
+	mustRule := func(id string, effect trigger.Effect, target, condition string) *trigger.Rule {
+		rule, err := trigger.NewRule(id, effect, target, condition)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		return rule
+	}
+	rules := []*trigger.Rule{
+		mustRule("members-read", trigger.Permit, "this.action == 'read'", "this.org == this.resource_org"),
+		mustRule("admins", trigger.Permit, "", "this.role == 'admin'"),
+		mustRule("suspended", trigger.Forbid, "", "this.suspended"),
+	}
+	tests := []struct {
+		name      string
+		algorithm trigger.CombiningAlgorithm
+		data      map[string]interface{}
+		want      *trigger.Authorization
+	}{
+		{
+			name:      "deny overrides",
+			algorithm: trigger.DenyOverrides,
+			data:      map[string]interface{}{"action": "read", "org": "acme", "resource_org": "acme", "role": "admin", "suspended": true},
+			want:      &trigger.Authorization{Effect: trigger.Forbid, Rules: []string{"suspended"}},
+		},
+		{
+			name:      "permit overrides",
+			algorithm: trigger.PermitOverrides,
+			data:      map[string]interface{}{"action": "read", "org": "acme", "resource_org": "acme", "role": "admin", "suspended": true},
+			want:      &trigger.Authorization{Effect: trigger.Permit, Rules: []string{"members-read", "admins"}},
+		},
+		{
+			name:      "first match",
+			algorithm: trigger.FirstMatch,
+			data:      map[string]interface{}{"action": "write", "org": "acme", "resource_org": "acme", "role": "admin", "suspended": true},
+			want:      &trigger.Authorization{Effect: trigger.Permit, Rules: []string{"admins"}},
+		},
+		{
+			name:      "default",
+			algorithm: trigger.DenyOverrides,
+			data:      map[string]interface{}{"action": "write", "org": "acme", "resource_org": "acme", "role": "viewer", "suspended": false},
+			want:      &trigger.Authorization{Effect: trigger.Forbid, Default: true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy, err := trigger.NewPolicy(tt.algorithm, rules...)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			got, err := policy.Authorize(tt.data)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Authorize() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
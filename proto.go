@@ -0,0 +1,94 @@
+package trigger
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/pkg/errors"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// WithTypes registers protobuf message types with the Env so they may be passed as inputs & constructed within expressions
+func WithTypes(msgs ...proto.Message) EnvOption {
+	return func(o *envOptions) {
+		o.types = append(o.types, msgs...)
+	}
+}
+
+// EvalProto evaluates the boolean CEL expressions against the protobuf message. The message type must be registered
+// with the Env via WithTypes or WithSchema.
+func (n *Decision) EvalProto(msg proto.Message) error {
+	return n.EvalVars(map[string]interface{}{
+		"this": msg,
+	})
+}
+
+// TriggerProto executes it's decision against the protobuf message and then returns a copy of the message patched with
+// the trigger's output. The output may be a map of field names to values or a message of the same type, in which case
+// it's populated fields are copied. The message type must be registered with the Env via WithTypes or WithSchema.
+func (t *Trigger) TriggerProto(msg proto.Message) (proto.Message, error) {
+	out, err := t.eval(context.Background(), map[string]interface{}{
+		"this": msg,
+	})
+	if err != nil {
+		return nil, err
+	}
+	result := proto.Clone(msg)
+	if out == nil {
+		return result, nil
+	}
+	if patch, ok := out.Value().(proto.Message); ok {
+		if patch.ProtoReflect().Descriptor().FullName() != result.ProtoReflect().Descriptor().FullName() {
+			return nil, errors.Errorf("trigger: expected output of type %s, got %s",
+				result.ProtoReflect().Descriptor().FullName(),
+				patch.ProtoReflect().Descriptor().FullName(),
+			)
+		}
+		dest := result.ProtoReflect()
+		patch.ProtoReflect().Range(func(fd protoreflect.FieldDescriptor, value protoreflect.Value) bool {
+			dest.Set(dest.Descriptor().Fields().ByNumber(fd.Number()), value)
+			return true
+		})
+		return result, nil
+	}
+	if err := patchProto(result, toPatch(out)); err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to patch %s (%s)", result.ProtoReflect().Descriptor().FullName(), t.expression)
+	}
+	return result, nil
+}
+
+// patchProto overwrites the fields of the message with the values in the patch. nil values clear the field.
+func patchProto(msg proto.Message, patch map[string]interface{}) error {
+	dest := msg.ProtoReflect()
+	fields := dest.Descriptor().Fields()
+	for key, value := range patch {
+		fd := fields.ByName(protoreflect.Name(key))
+		if fd == nil {
+			fd = fields.ByJSONName(key)
+		}
+		if fd == nil {
+			return errors.Errorf("unknown field %s", key)
+		}
+		if value == nil {
+			dest.Clear(fd)
+			continue
+		}
+		if m, ok := value.(proto.Message); ok && fd.Message() != nil && m.ProtoReflect().Descriptor().FullName() == fd.Message().FullName() {
+			dest.Set(fd, protoreflect.ValueOfMessage(m.ProtoReflect()))
+			continue
+		}
+		bits, err := json.Marshal(map[string]interface{}{
+			fd.JSONName(): value,
+		})
+		if err != nil {
+			return errors.Wrapf(err, "field %s", key)
+		}
+		tmp := dest.New().Interface()
+		if err := protojson.Unmarshal(bits, tmp); err != nil {
+			return errors.Wrapf(err, "field %s", key)
+		}
+		dest.Set(fd, tmp.ProtoReflect().Get(fd))
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"google.golang.org/protobuf/types/known/apipb"
+	"testing"
+)
+
+func TestTrigger_TriggerProto(t *testing.T) {
+	env, err := trigger.NewEnv(trigger.WithSchema("this", trigger.NewProtoSchema(&apipb.Method{})))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	method := &apipb.Method{
+		Name:             "GetUser",
+		RequestTypeUrl:   "type.googleapis.com/acme.GetUserRequest",
+		RequestStreaming: true,
+	}
+	decision, err := env.NewDecision("this.request_streaming && this.name.startsWith('Get')")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalProto(method); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := env.NewDecision("this.nmae == 'GetUser'"); err == nil {
+		t.Fatal("expected unknown field to fail compilation")
+	}
+	trigg, err := env.NewTrigger(decision, "{'name': this.name.upperCase(), 'response_streaming': true}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	out, err := trigg.TriggerProto(method)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	patched := out.(*apipb.Method)
+	if patched.Name != "GETUSER" || !patched.ResponseStreaming || patched.RequestTypeUrl != method.RequestTypeUrl {
+		t.Fatalf("unexpected patched message: %v", patched)
+	}
+	if method.Name != "GetUser" {
+		t.Fatal("expected input message to be unmodified")
+	}
+	trigg, err = env.NewTrigger(decision, "google.protobuf.Method{name: 'ListUsers'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	out, err = trigg.TriggerProto(method)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if out.(*apipb.Method).Name != "ListUsers" || !out.(*apipb.Method).RequestStreaming {
+		t.Fatalf("unexpected populated message: %v", out)
+	}
+}
+
+func TestDecision_EvalProto(t *testing.T) {
+	env, err := trigger.NewEnv(trigger.WithTypes(&apipb.Method{}))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("this.name == 'GetUser'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalProto(&apipb.Method{Name: "GetUser"}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,187 @@
+package trigger
+
+import (
+	"context"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/pkg/errors"
+	"time"
+)
+
+// DecisionErrorPolicy determines how a Trigger handles a decision that fails to evaluate, ex: no such key. A decision
+// that exceeds a limit (ErrCostLimitExceeded) or whose context is done always fails, whatever the policy.
+type DecisionErrorPolicy int
+
+const (
+	// DecisionErrorSkip treats a decision that fails to evaluate like a denial: the trigger doesn't fire & no error
+	// is returned. Fire reports the error with TriggerErrored. Exceeded limits are returned as errors.
+	DecisionErrorSkip DecisionErrorPolicy = iota
+	// DecisionErrorFail returns the decision's evaluation error
+	DecisionErrorFail
+)
+
+// WithDecisionErrorPolicy sets how triggers created by the Env handle decisions that fail to evaluate
+// (default: DecisionErrorSkip)
+func WithDecisionErrorPolicy(policy DecisionErrorPolicy) EnvOption {
+	return func(o *envOptions) {
+		o.onDecisionError = policy
+	}
+}
+
+// WithDecisionErrorPolicy returns a copy of the trigger that handles decisions that fail to evaluate with the policy
+func (t *Trigger) WithDecisionErrorPolicy(policy DecisionErrorPolicy) *Trigger {
+	cpy := *t
+	cpy.onDecisionError = policy
+	return &cpy
+}
+
+// TriggerStatus is the outcome of executing a Trigger
+type TriggerStatus int
+
+const (
+	// TriggerSkipped means the trigger's decision denied
+	TriggerSkipped TriggerStatus = iota
+	// TriggerFired means the trigger's decision allowed & it's mutation was executed, or the decision denied & it's
+	// else mutation was executed
+	TriggerFired
+	// TriggerErrored means the trigger's decision or mutation failed to evaluate
+	TriggerErrored
+)
+
+// String returns the name of the status
+func (s TriggerStatus) String() string {
+	switch s {
+	case TriggerSkipped:
+		return "skipped"
+	case TriggerFired:
+		return "fired"
+	case TriggerErrored:
+		return "errored"
+	}
+	return "unknown"
+}
+
+// TriggerResult is the outcome of executing a Trigger
+type TriggerResult struct {
+	// Status is whether the trigger fired, skipped or errored
+	Status TriggerStatus
+	// Fired is true if the trigger's decision allowed & it's mutation was executed, even if the patch is empty.
+	// It is false if the else mutation was executed, see Else.
+	Fired bool
+	// Else is true if the trigger's decision denied & it's else mutation was executed
+	Else bool
+	// Patch holds the fields of the executed mutation's output. It is empty unless a mutation was executed & the output
+	// is a map.
+	Patch map[string]interface{}
+	// RawValue is the executed mutation's output, including outputs that aren't maps. It is nil unless a mutation was
+	// executed.
+	RawValue ref.Val
+	// Err is the reason the trigger errored
+	Err error
+	// DecisionDuration & MutationDuration are how long the decision & mutation took to evaluate
+	DecisionDuration time.Duration
+	MutationDuration time.Duration
+	// Explanation is a trace of the decision's evaluation. It is only set if Fire is called with WithExplanation.
+	Explanation *Explanation
+}
+
+type fireOptions struct {
+	explain bool
+}
+
+// FireOption configures the execution of a Trigger by Fire
+type FireOption func(o *fireOptions)
+
+// WithExplanation traces the evaluation of the trigger's decision into the result's Explanation, see Decision.Explain.
+// The decision is evaluated a second time to produce the trace.
+func WithExplanation() FireOption {
+	return func(o *fireOptions) {
+		o.explain = true
+	}
+}
+
+// Fire executes the trigger against the Mapper & reports whether it fired, skipped or errored along with it's raw
+// output & timings. An error is returned if the mutation fails, the decision exceeds a limit or the decision fails &
+// the trigger's DecisionErrorPolicy is DecisionErrorFail.
+func (t *Trigger) Fire(data map[string]interface{}, opts ...FireOption) (*TriggerResult, error) {
+	return t.FireContext(context.Background(), data, opts...)
+}
+
+// FireContext is like Fire but evaluation is stopped once the context is done
+func (t *Trigger) FireContext(ctx context.Context, data map[string]interface{}, opts ...FireOption) (*TriggerResult, error) {
+	options := &fireOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	vars := map[string]interface{}{
+		"this": data,
+	}
+	result, out, err := t.fire(ctx, vars)
+	if out != nil {
+		result.RawValue = out
+		if patch, ok := patchFields(out); ok {
+			result.Patch = patch
+		}
+	}
+	if options.explain && t.decision != nil && ctx.Err() == nil {
+		explanation, explainErr := t.decision.explainVars(ctx, vars)
+		if explainErr != nil && err == nil {
+			return result, explainErr
+		}
+		result.Explanation = explanation
+	}
+	return result, err
+}
+
+// escalate returns true if the decision error must be returned: the context is done, a limit was exceeded or the
+// trigger's DecisionErrorPolicy is DecisionErrorFail
+func (t *Trigger) escalate(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Cause(err) == ErrCostLimitExceeded || t.onDecisionError == DecisionErrorFail
+}
+
+// fire executes the trigger's decision & then it's mutation or else mutation. The raw output of the mutation is nil
+// unless the trigger fired.
+func (t *Trigger) fire(ctx context.Context, vars map[string]interface{}) (*TriggerResult, ref.Val, error) {
+	result := &TriggerResult{
+		Status: TriggerSkipped,
+		Patch:  map[string]interface{}{},
+	}
+	fail := func(err error) (*TriggerResult, ref.Val, error) {
+		result.Status = TriggerErrored
+		result.Err = err
+		return result, nil, err
+	}
+	vars, err := t.env.vars(vars)
+	if err != nil {
+		return fail(err)
+	}
+	mutation := t
+	if t.decision != nil {
+		start := time.Now()
+		err := t.decision.evalVars(ctx, vars)
+		result.DecisionDuration = time.Since(start)
+		if err != nil {
+			if errors.Cause(err) != ErrDecisionDenied {
+				if t.escalate(ctx, err) {
+					return fail(err)
+				}
+				result.Status = TriggerErrored
+				result.Err = err
+				return result, nil, nil
+			}
+			if t.otherwise == nil {
+				return result, nil, nil
+			}
+			mutation = t.otherwise
+			result.Else = true
+		}
+	}
+	start := time.Now()
+	out, err := mutation.mutate(ctx, vars)
+	result.MutationDuration = time.Since(start)
+	if err != nil {
+		return fail(err)
+	}
+	result.Status = TriggerFired
+	result.Fired = !result.Else
+	return result, out, nil
+}
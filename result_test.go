@@ -0,0 +1,153 @@
+package trigger_test
+
+import (
+	"github.com/google/cel-go/checker/decls"
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+func TestTrigger_Fire(t *testing.T) {
+	tr, err := trigger.NewArrowTrigger("this.user.name == 'bob' => {'greeting': 'hello bob'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tests := []struct {
+		name   string
+		policy trigger.DecisionErrorPolicy
+		data   map[string]interface{}
+		status trigger.TriggerStatus
+		patch  map[string]interface{}
+		err    bool
+	}{
+		{
+			name:   "fired",
+			data:   map[string]interface{}{"user": map[string]interface{}{"name": "bob"}},
+			status: trigger.TriggerFired,
+			patch:  map[string]interface{}{"greeting": "hello bob"},
+		},
+		{
+			name:   "skipped",
+			data:   map[string]interface{}{"user": map[string]interface{}{"name": "alice"}},
+			status: trigger.TriggerSkipped,
+			patch:  map[string]interface{}{},
+		},
+		{
+			name:   "errored & skipped",
+			policy: trigger.DecisionErrorSkip,
+			data:   map[string]interface{}{},
+			status: trigger.TriggerErrored,
+			patch:  map[string]interface{}{},
+		},
+		{
+			name:   "errored & failed",
+			policy: trigger.DecisionErrorFail,
+			data:   map[string]interface{}{},
+			status: trigger.TriggerErrored,
+			err:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := tr.WithDecisionErrorPolicy(tt.policy)
+			result, err := tr.Fire(tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error = %v, got: %v", tt.err, err)
+			}
+			if result.Status != tt.status {
+				t.Fatalf("expected %s, got: %s", tt.status, result.Status)
+			}
+			if tt.status == trigger.TriggerErrored && result.Err == nil {
+				t.Fatal("expected the decision error to be reported")
+			}
+			patch, err := tr.Trigger(tt.data)
+			if (err != nil) != tt.err {
+				t.Fatalf("expected error = %v, got: %v", tt.err, err)
+			}
+			if !tt.err && !reflect.DeepEqual(patch, tt.patch) {
+				t.Fatalf("expected %v, got: %v", tt.patch, patch)
+			}
+		})
+	}
+}
+
+func TestTrigger_Fire_Details(t *testing.T) {
+	tr, err := trigger.NewArrowTrigger("this.score > 10 => this.score * 2")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err := tr.Fire(map[string]interface{}{"score": 20}, trigger.WithExplanation())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !result.Fired || result.Status != trigger.TriggerFired {
+		t.Fatalf("expected the trigger to fire, got: %s", result.Status)
+	}
+	if result.RawValue == nil || result.RawValue.Value() != int64(40) {
+		t.Fatalf("expected a raw value of 40, got: %v", result.RawValue)
+	}
+	if len(result.Patch) != 0 {
+		t.Fatalf("expected an empty patch for a non-map output, got: %v", result.Patch)
+	}
+	if result.DecisionDuration <= 0 || result.MutationDuration <= 0 {
+		t.Fatalf("expected durations, got: %v %v", result.DecisionDuration, result.MutationDuration)
+	}
+	if result.Explanation == nil || !result.Explanation.Allowed {
+		t.Fatalf("expected an allowed explanation, got: %v", result.Explanation)
+	}
+	result, err = tr.Fire(map[string]interface{}{"score": 5})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Fired || result.RawValue != nil || result.MutationDuration != 0 || result.Explanation != nil {
+		t.Fatalf("expected a skipped result without mutation details, got: %+v", result)
+	}
+}
+
+func TestTrigger_Fire_Limits(t *testing.T) {
+	env, err := trigger.NewEnv(
+		trigger.WithVariable("this", decls.NewMapType(decls.String, decls.Dyn)),
+		trigger.WithLimits(trigger.Limits{MaxIterations: 5}),
+		trigger.WithDecisionErrorPolicy(trigger.DecisionErrorSkip),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tr, err := env.NewArrowTrigger("this.items.all(i, i > 0) => {'valid': true}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	var items []interface{}
+	for i := 1; i <= 100; i++ {
+		items = append(items, i)
+	}
+	result, err := tr.Fire(map[string]interface{}{"items": items})
+	if errors.Cause(err) != trigger.ErrCostLimitExceeded {
+		t.Fatalf("expected cost limit exceeded, got: %v", err)
+	}
+	if result.Status != trigger.TriggerErrored || result.Fired {
+		t.Fatalf("expected %s, got: %s", trigger.TriggerErrored, result.Status)
+	}
+}
+
+func TestTrigger_Fire_Else(t *testing.T) {
+	tr, err := trigger.NewArrowTrigger("this.status == 'new' => {'status': 'processed'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tr, err = tr.WithElse("{'status': 'ignored'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	result, err := tr.Fire(map[string]interface{}{"status": "old"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result.Status != trigger.TriggerFired || result.Fired || !result.Else {
+		t.Fatalf("expected the else mutation to be executed, got: %s fired = %v else = %v", result.Status, result.Fired, result.Else)
+	}
+	if result.Patch["status"] != "ignored" {
+		t.Fatalf("expected the else patch, got: %v", result.Patch)
+	}
+}
@@ -0,0 +1,742 @@
+package trigger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/pkg/errors"
+	"github.com/zclconf/go-cty/cty/gocty"
+	"gopkg.in/yaml.v3"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+var ErrUnknownRuleFormat = errors.New("trigger: unknown rule set format")
+
+// RuleFormat is the file format of a rule set
+type RuleFormat int
+
+const (
+	// RuleFormatJSON reads rules from a json object: {"rules": [{"id": "...", "decision": "...", "mutation": "..."}]}
+	RuleFormatJSON RuleFormat = iota
+	// RuleFormatYAML reads rules from a yaml document with a top-level rules list
+	RuleFormatYAML
+	// RuleFormatHCL reads rules from hcl blocks: rule "id" { decision = "..." mutation = "..." }
+	RuleFormatHCL
+	// RuleFormatDSL reads rules written in the rule language, see Env.ParseRules
+	RuleFormatDSL
+)
+
+// String returns the name of the format
+func (f RuleFormat) String() string {
+	switch f {
+	case RuleFormatJSON:
+		return "json"
+	case RuleFormatYAML:
+		return "yaml"
+	case RuleFormatHCL:
+		return "hcl"
+	case RuleFormatDSL:
+		return "dsl"
+	}
+	return "unknown"
+}
+
+// RuleFormatFromPath returns the rule set format of a file from it's extension: .json, .yaml, .yml, .hcl or .rules
+func RuleFormatFromPath(path string) (RuleFormat, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return RuleFormatJSON, nil
+	case ".yaml", ".yml":
+		return RuleFormatYAML, nil
+	case ".hcl":
+		return RuleFormatHCL, nil
+	case ".rules":
+		return RuleFormatDSL, nil
+	}
+	return 0, errors.Wrapf(ErrUnknownRuleFormat, "file %s", path)
+}
+
+// TriggerRule is a named Trigger loaded from a rule set
+type TriggerRule struct {
+	// ID identifies the rule within the rule set
+	ID string
+	// Description is a human readable description of the rule
+	Description string
+	// Priority orders the rules of a rule set. Rules with a higher priority come first.
+	Priority int
+	// Enabled is false if the rule should not be executed. It defaults to true.
+	Enabled bool
+	// Trigger is the rule's compiled decision & mutation along with it's else mutation, if any
+	Trigger *Trigger
+}
+
+// RuleSet is a set of named triggers ordered by priority
+type RuleSet struct {
+	rules []*TriggerRule
+	ids   map[string]*TriggerRule
+}
+
+// NewRuleSet creates a RuleSet from the rules. Rules are ordered by descending priority, then by the given order.
+func NewRuleSet(rules ...*TriggerRule) (*RuleSet, error) {
+	r := &RuleSet{
+		ids: map[string]*TriggerRule{},
+	}
+	for _, rule := range rules {
+		if rule.Trigger == nil {
+			return nil, errors.Errorf("trigger: rule %s has no trigger", rule.ID)
+		}
+		if _, ok := r.ids[rule.ID]; ok {
+			return nil, errors.Errorf("trigger: duplicate rule %s", rule.ID)
+		}
+		r.ids[rule.ID] = rule
+		r.rules = append(r.rules, rule)
+	}
+	sort.SliceStable(r.rules, func(i, j int) bool {
+		return r.rules[i].Priority > r.rules[j].Priority
+	})
+	return r, nil
+}
+
+// Rules returns every rule of the set ordered by priority
+func (r *RuleSet) Rules() []*TriggerRule {
+	return append([]*TriggerRule{}, r.rules...)
+}
+
+// Enabled returns the enabled rules of the set ordered by priority
+func (r *RuleSet) Enabled() []*TriggerRule {
+	var enabled []*TriggerRule
+	for _, rule := range r.rules {
+		if rule.Enabled {
+			enabled = append(enabled, rule)
+		}
+	}
+	return enabled
+}
+
+// Triggers returns the triggers of the enabled rules ordered by priority
+func (r *RuleSet) Triggers() []*Trigger {
+	var triggers []*Trigger
+	for _, rule := range r.Enabled() {
+		triggers = append(triggers, rule.Trigger)
+	}
+	return triggers
+}
+
+// Get returns the rule with the given id
+func (r *RuleSet) Get(id string) (*TriggerRule, bool) {
+	rule, ok := r.ids[id]
+	return rule, ok
+}
+
+// Len returns the number of rules in the set
+func (r *RuleSet) Len() int {
+	return len(r.rules)
+}
+
+// RuleError is a problem with a rule set file. Line & Column are 1-based & zero if the position is unknown.
+type RuleError struct {
+	File   string
+	Line   int
+	Column int
+	// Rule is the id of the rule the problem was found in, if any
+	Rule string
+	Err  error
+}
+
+// Error returns the error as file:line:column: rule id: message
+func (e *RuleError) Error() string {
+	var position []string
+	if e.File != "" {
+		position = append(position, e.File)
+	}
+	if e.Line > 0 {
+		position = append(position, fmt.Sprint(e.Line))
+		if e.Column > 0 {
+			position = append(position, fmt.Sprint(e.Column))
+		}
+	}
+	msg := e.Err.Error()
+	if e.Rule != "" {
+		msg = fmt.Sprintf("rule %s: %s", e.Rule, msg)
+	}
+	if len(position) == 0 {
+		return msg
+	}
+	return fmt.Sprintf("%s: %s", strings.Join(position, ":"), msg)
+}
+
+// Unwrap returns the underlying error
+func (e *RuleError) Unwrap() error {
+	return e.Err
+}
+
+// RuleSetError holds every problem found while loading a rule set
+type RuleSetError struct {
+	Errors []*RuleError
+}
+
+// Error returns every problem, one per line
+func (e *RuleSetError) Error() string {
+	var lines []string
+	for _, err := range e.Errors {
+		lines = append(lines, err.Error())
+	}
+	return fmt.Sprintf("trigger: failed to load rule set:\n%s", strings.Join(lines, "\n"))
+}
+
+// LoadRuleSet reads & compiles a rule set using the default Env
+func LoadRuleSet(r io.Reader, format RuleFormat) (*RuleSet, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.LoadRuleSet(r, format)
+}
+
+// LoadRuleSetFile reads & compiles a rule set file using the default Env. The format is determined by the file extension.
+func LoadRuleSetFile(path string) (*RuleSet, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.LoadRuleSetFile(path)
+}
+
+// LoadRuleSet reads & compiles a rule set. Each rule has an id, an optional description, a decision, a mutation,
+// an optional priority & an optional enabled flag. Every rule is compiled & all problems are returned together
+// as a *RuleSetError.
+func (e *Env) LoadRuleSet(r io.Reader, format RuleFormat) (*RuleSet, error) {
+	src, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, errors.Wrap(err, "trigger: failed to read rule set")
+	}
+	return e.loadRuleSet(src, "", format)
+}
+
+// LoadRuleSetFile reads & compiles a rule set file. The format is determined by the file extension.
+func (e *Env) LoadRuleSetFile(path string) (*RuleSet, error) {
+	format, err := RuleFormatFromPath(path)
+	if err != nil {
+		return nil, err
+	}
+	src, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "trigger: failed to read rule set")
+	}
+	return e.loadRuleSet(src, path, format)
+}
+
+func (e *Env) loadRuleSet(src []byte, file string, format RuleFormat) (*RuleSet, error) {
+	var (
+		specs []*ruleSpec
+		errs  []*RuleError
+	)
+	switch format {
+	case RuleFormatJSON:
+		specs, errs = parseJSONRules(src)
+	case RuleFormatYAML:
+		specs, errs = parseYAMLRules(src)
+	case RuleFormatHCL:
+		specs, errs = parseHCLRules(src, file)
+	case RuleFormatDSL:
+		specs, errs = parseDSLRules(src)
+	default:
+		return nil, errors.Wrapf(ErrUnknownRuleFormat, "format %v", format)
+	}
+	var rules []*TriggerRule
+	ids := map[string]bool{}
+	for _, spec := range specs {
+		rule, ruleErrs := e.compileRule(spec)
+		errs = append(errs, ruleErrs...)
+		if spec.id != "" && ids[spec.id] {
+			errs = append(errs, &RuleError{
+				Line:   spec.line,
+				Column: spec.column,
+				Rule:   spec.id,
+				Err:    errors.New("duplicate rule id"),
+			})
+		}
+		ids[spec.id] = true
+		if rule != nil {
+			rules = append(rules, rule)
+		}
+	}
+	if len(errs) > 0 {
+		for _, err := range errs {
+			err.File = file
+		}
+		sort.SliceStable(errs, func(i, j int) bool {
+			if errs[i].Line != errs[j].Line {
+				return errs[i].Line < errs[j].Line
+			}
+			return errs[i].Column < errs[j].Column
+		})
+		return nil, &RuleSetError{Errors: errs}
+	}
+	return NewRuleSet(rules...)
+}
+
+// ruleField is a decision or mutation expression along with the position of it's first character
+type ruleField struct {
+	value  string
+	line   int
+	column int
+	// block is true if the expression starts on the line after line, ex: a yaml literal block or an hcl heredoc
+	block bool
+	// indent is the indentation stripped from each line of a block
+	indent int
+	// mapper overrides the mapping of positions within the expression to positions within the file
+	mapper func(line, column int) (int, int)
+}
+
+// position returns the position in the rule set file of a position within the field's expression
+func (f ruleField) position(line, column int) (int, int) {
+	switch {
+	case f.mapper != nil:
+		return f.mapper(line, column)
+	case f.line == 0:
+		return 0, 0
+	case f.block:
+		return f.line + line, f.indent + column
+	case line > 1:
+		return f.line + line - 1, column
+	}
+	return f.line, f.column + column - 1
+}
+
+// ruleSpec is a rule as read from a rule set file
+type ruleSpec struct {
+	id          string
+	description string
+	priority    int
+	enabled     bool
+	decision    ruleField
+	mutation    ruleField
+	otherwise   ruleField
+	line        int
+	column      int
+}
+
+func (e *Env) compileRule(spec *ruleSpec) (*TriggerRule, []*RuleError) {
+	var errs []*RuleError
+	fail := func(field ruleField, err error) {
+		if compileErr, ok := errors.Cause(err).(*CompileError); ok {
+			for _, issue := range compileErr.Issues {
+				line, column := field.position(issue.Line, issue.Column)
+				errs = append(errs, &RuleError{
+					Line:   line,
+					Column: column,
+					Rule:   spec.id,
+					Err:    errors.New(issue.Message),
+				})
+			}
+			return
+		}
+		line, column := field.position(1, 1)
+		errs = append(errs, &RuleError{
+			Line:   line,
+			Column: column,
+			Rule:   spec.id,
+			Err:    err,
+		})
+	}
+	if spec.id == "" {
+		errs = append(errs, &RuleError{
+			Line:   spec.line,
+			Column: spec.column,
+			Err:    errors.New("missing rule id"),
+		})
+	}
+	if strings.TrimSpace(spec.decision.value) == "" {
+		errs = append(errs, &RuleError{
+			Line:   spec.line,
+			Column: spec.column,
+			Rule:   spec.id,
+			Err:    errors.New("missing decision"),
+		})
+	}
+	if strings.TrimSpace(spec.mutation.value) == "" {
+		errs = append(errs, &RuleError{
+			Line:   spec.line,
+			Column: spec.column,
+			Rule:   spec.id,
+			Err:    errors.New("missing mutation"),
+		})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	decision, err := e.NewDecision(spec.decision.value)
+	if err != nil {
+		fail(spec.decision, err)
+		// compile the mutation anyway so all of the rule's problems are reported
+		if _, err := e.compile(spec.mutation.value); err != nil {
+			fail(spec.mutation, err)
+		}
+		return nil, errs
+	}
+	rule := &TriggerRule{
+		ID:          spec.id,
+		Description: spec.description,
+		Priority:    spec.priority,
+		Enabled:     spec.enabled,
+	}
+	if rule.Trigger, err = e.NewTrigger(decision, spec.mutation.value); err != nil {
+		fail(spec.mutation, err)
+	}
+	if spec.otherwise.value != "" {
+		if rule.Trigger == nil {
+			// compile the else mutation anyway so all of the rule's problems are reported
+			_, err = e.compile(spec.otherwise.value)
+		} else {
+			rule.Trigger, err = rule.Trigger.WithElse(spec.otherwise.value)
+		}
+		if err != nil {
+			fail(spec.otherwise, err)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return rule, nil
+}
+
+type yamlRuleSet struct {
+	Rules []yaml.Node `yaml:"rules"`
+}
+
+type yamlRule struct {
+	ID          string    `yaml:"id"`
+	Description string    `yaml:"description"`
+	Decision    yaml.Node `yaml:"decision"`
+	Mutation    yaml.Node `yaml:"mutation"`
+	Priority    int       `yaml:"priority"`
+	Enabled     *bool     `yaml:"enabled"`
+}
+
+func parseYAMLRules(src []byte) ([]*ruleSpec, []*RuleError) {
+	var set yamlRuleSet
+	if err := yaml.Unmarshal(src, &set); err != nil {
+		return nil, []*RuleError{{Err: err}}
+	}
+	var (
+		specs []*ruleSpec
+		errs  []*RuleError
+	)
+	for _, node := range set.Rules {
+		var rule yamlRule
+		if err := node.Decode(&rule); err != nil {
+			errs = append(errs, &RuleError{Line: node.Line, Column: node.Column, Err: err})
+			continue
+		}
+		spec := &ruleSpec{
+			id:          rule.ID,
+			description: rule.Description,
+			priority:    rule.Priority,
+			enabled:     rule.Enabled == nil || *rule.Enabled,
+			decision:    yamlField(src, rule.Decision),
+			mutation:    yamlField(src, rule.Mutation),
+			line:        node.Line,
+			column:      node.Column,
+		}
+		specs = append(specs, spec)
+	}
+	return specs, errs
+}
+
+func yamlField(src []byte, node yaml.Node) ruleField {
+	f := ruleField{
+		value:  node.Value,
+		line:   node.Line,
+		column: node.Column,
+	}
+	switch node.Style {
+	case yaml.DoubleQuotedStyle, yaml.SingleQuotedStyle:
+		f.column++
+	case yaml.LiteralStyle, yaml.FoldedStyle:
+		f.block = true
+		f.indent = indentation(src, node.Line+1)
+	}
+	return f
+}
+
+func parseJSONRules(src []byte) ([]*ruleSpec, []*RuleError) {
+	p := &jsonRuleParser{
+		src: src,
+		dec: json.NewDecoder(bytes.NewReader(src)),
+	}
+	specs, err := p.parse()
+	if err != nil {
+		return nil, []*RuleError{p.error(err)}
+	}
+	return specs, nil
+}
+
+// jsonRuleParser reads a json rule set token by token so the position of each rule's expressions is known
+type jsonRuleParser struct {
+	src []byte
+	dec *json.Decoder
+}
+
+func (p *jsonRuleParser) parse() ([]*ruleSpec, error) {
+	if err := p.delim('{'); err != nil {
+		return nil, err
+	}
+	var specs []*ruleSpec
+	for p.dec.More() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		if key != "rules" {
+			if err := p.dec.Decode(&json.RawMessage{}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if err := p.delim('['); err != nil {
+			return nil, err
+		}
+		for p.dec.More() {
+			spec, err := p.rule()
+			if err != nil {
+				return nil, err
+			}
+			specs = append(specs, spec)
+		}
+		if err := p.delim(']'); err != nil {
+			return nil, err
+		}
+	}
+	return specs, p.delim('}')
+}
+
+func (p *jsonRuleParser) rule() (*ruleSpec, error) {
+	spec := &ruleSpec{
+		enabled: true,
+	}
+	spec.line, spec.column = p.position(p.next())
+	if err := p.delim('{'); err != nil {
+		return nil, err
+	}
+	for p.dec.More() {
+		key, err := p.key()
+		if err != nil {
+			return nil, err
+		}
+		offset := p.next()
+		switch key {
+		case "id":
+			err = p.dec.Decode(&spec.id)
+		case "description":
+			err = p.dec.Decode(&spec.description)
+		case "priority":
+			err = p.dec.Decode(&spec.priority)
+		case "enabled":
+			err = p.dec.Decode(&spec.enabled)
+		case "decision", "mutation":
+			field := ruleField{}
+			field.line, field.column = p.position(offset)
+			// skip the opening quote
+			field.column++
+			err = p.dec.Decode(&field.value)
+			if key == "decision" {
+				spec.decision = field
+			} else {
+				spec.mutation = field
+			}
+		default:
+			return nil, &RuleError{Err: errors.Errorf("unknown field %s", key), Line: spec.line, Column: spec.column}
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	return spec, p.delim('}')
+}
+
+func (p *jsonRuleParser) key() (string, error) {
+	tok, err := p.dec.Token()
+	if err != nil {
+		return "", err
+	}
+	key, ok := tok.(string)
+	if !ok {
+		return "", &json.SyntaxError{Offset: p.dec.InputOffset()}
+	}
+	return key, nil
+}
+
+func (p *jsonRuleParser) delim(d json.Delim) error {
+	offset := p.next()
+	tok, err := p.dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != d {
+		line, column := p.position(offset)
+		return &RuleError{Line: line, Column: column, Err: errors.Errorf("expected %s", d)}
+	}
+	return nil
+}
+
+// next returns the offset of the next value, skipping whitespace & separators
+func (p *jsonRuleParser) next() int {
+	offset := int(p.dec.InputOffset())
+	for offset < len(p.src) && strings.ContainsRune(" \t\r\n,:", rune(p.src[offset])) {
+		offset++
+	}
+	return offset
+}
+
+// position returns the 1-based line & column of the byte offset
+func (p *jsonRuleParser) position(offset int) (int, int) {
+	if offset > len(p.src) {
+		offset = len(p.src)
+	}
+	before := p.src[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	return line, utf8.RuneCount(before[bytes.LastIndexByte(before, '\n')+1:]) + 1
+}
+
+func (p *jsonRuleParser) error(err error) *RuleError {
+	switch e := err.(type) {
+	case *RuleError:
+		return e
+	case *json.SyntaxError:
+		line, column := p.position(int(e.Offset))
+		return &RuleError{Line: line, Column: column, Err: err}
+	case *json.UnmarshalTypeError:
+		line, column := p.position(int(e.Offset))
+		return &RuleError{Line: line, Column: column, Err: err}
+	}
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	line, column := p.position(int(p.dec.InputOffset()))
+	return &RuleError{Line: line, Column: column, Err: err}
+}
+
+func parseHCLRules(src []byte, file string) ([]*ruleSpec, []*RuleError) {
+	f, diags := hclsyntax.ParseConfig(src, file, hcl.Pos{Line: 1, Column: 1})
+	if diags.HasErrors() {
+		return nil, hclErrors(diags, "")
+	}
+	body := f.Body.(*hclsyntax.Body)
+	var errs []*RuleError
+	for name, attr := range body.Attributes {
+		errs = append(errs, &RuleError{
+			Line:   attr.SrcRange.Start.Line,
+			Column: attr.SrcRange.Start.Column,
+			Err:    errors.Errorf("unexpected attribute %s", name),
+		})
+	}
+	var specs []*ruleSpec
+	for _, block := range body.Blocks {
+		if block.Type != "rule" || len(block.Labels) != 1 {
+			errs = append(errs, &RuleError{
+				Line:   block.TypeRange.Start.Line,
+				Column: block.TypeRange.Start.Column,
+				Err:    errors.Errorf(`expected a block of the form rule "id" { ... }`),
+			})
+			continue
+		}
+		spec := &ruleSpec{
+			id:      block.Labels[0],
+			enabled: true,
+			line:    block.TypeRange.Start.Line,
+			column:  block.TypeRange.Start.Column,
+		}
+		for name, attr := range block.Body.Attributes {
+			var target interface{}
+			switch name {
+			case "description":
+				target = &spec.description
+			case "priority":
+				target = &spec.priority
+			case "enabled":
+				target = &spec.enabled
+			case "decision":
+				spec.decision = hclField(src, attr)
+				target = &spec.decision.value
+			case "mutation":
+				spec.mutation = hclField(src, attr)
+				target = &spec.mutation.value
+			default:
+				errs = append(errs, &RuleError{
+					Line:   attr.SrcRange.Start.Line,
+					Column: attr.SrcRange.Start.Column,
+					Rule:   spec.id,
+					Err:    errors.Errorf("unknown field %s", name),
+				})
+				continue
+			}
+			val, diags := attr.Expr.Value(nil)
+			if diags.HasErrors() {
+				errs = append(errs, hclErrors(diags, spec.id)...)
+				continue
+			}
+			if err := gocty.FromCtyValue(val, target); err != nil {
+				errs = append(errs, &RuleError{
+					Line:   attr.Expr.Range().Start.Line,
+					Column: attr.Expr.Range().Start.Column,
+					Rule:   spec.id,
+					Err:    errors.Wrapf(err, "invalid %s", name),
+				})
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, errs
+}
+
+func hclField(src []byte, attr *hclsyntax.Attribute) ruleField {
+	start := attr.Expr.Range().Start
+	f := ruleField{
+		line:   start.Line,
+		column: start.Column,
+	}
+	switch {
+	case bytes.HasPrefix(src[start.Byte:], []byte(`"`)):
+		f.column++
+	case bytes.HasPrefix(src[start.Byte:], []byte(`<<-`)):
+		f.block = true
+		f.indent = indentation(src, start.Line+1)
+	case bytes.HasPrefix(src[start.Byte:], []byte(`<<`)):
+		f.block = true
+	}
+	return f
+}
+
+// indentation returns the number of leading spaces & tabs of the 1-based line
+func indentation(src []byte, line int) int {
+	lines := bytes.SplitN(src, []byte("\n"), line+1)
+	if line > len(lines) {
+		return 0
+	}
+	l := lines[line-1]
+	return len(l) - len(bytes.TrimLeft(l, " \t"))
+}
+
+func hclErrors(diags hcl.Diagnostics, rule string) []*RuleError {
+	var errs []*RuleError
+	for _, diag := range diags {
+		if diag.Severity != hcl.DiagError {
+			continue
+		}
+		err := &RuleError{
+			Rule: rule,
+			Err:  errors.Errorf("%s: %s", diag.Summary, diag.Detail),
+		}
+		if diag.Subject != nil {
+			err.Line, err.Column = diag.Subject.Start.Line, diag.Subject.Start.Column
+		}
+		errs = append(errs, err)
+	}
+	return errs
+}
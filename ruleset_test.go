@@ -0,0 +1,186 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"strings"
+	"testing"
+)
+
+func TestLoadRuleSet(t *testing.T) {
+	tests := []struct {
+		name   string
+		format trigger.RuleFormat
+		src    string
+	}{
+		{
+			name:   "json",
+			format: trigger.RuleFormatJSON,
+			src: `{
+  "rules": [
+    {"id": "hash", "description": "hash passwords", "decision": "this.event == 'signup'", "mutation": "{'password': this.password.sha1()}"},
+    {"id": "greet", "decision": "has(this.name)", "mutation": "{'greeting': 'hello'}", "priority": 10},
+    {"id": "off", "decision": "true", "mutation": "{'off': true}", "enabled": false}
+  ]
+}`,
+		},
+		{
+			name:   "yaml",
+			format: trigger.RuleFormatYAML,
+			src: `rules:
+  - id: hash
+    description: hash passwords
+    decision: this.event == 'signup'
+    mutation: "{'password': this.password.sha1()}"
+  - id: greet
+    decision: has(this.name)
+    mutation: |
+      {'greeting': 'hello'}
+    priority: 10
+  - id: "off"
+    decision: "true"
+    mutation: "{'off': true}"
+    enabled: false
+`,
+		},
+		{
+			name:   "hcl",
+			format: trigger.RuleFormatHCL,
+			src: `rule "hash" {
+  description = "hash passwords"
+  decision    = "this.event == 'signup'"
+  mutation    = "{'password': this.password.sha1()}"
+}
+
+rule "greet" {
+  decision = "has(this.name)"
+  mutation = "{'greeting': 'hello'}"
+  priority = 10
+}
+
+rule "off" {
+  decision = "true"
+  mutation = "{'off': true}"
+  enabled  = false
+}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			set, err := trigger.LoadRuleSet(strings.NewReader(tt.src), tt.format)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			var ids []string
+			for _, rule := range set.Rules() {
+				ids = append(ids, rule.ID)
+			}
+			if strings.Join(ids, ",") != "greet,hash,off" {
+				t.Fatalf("expected rules ordered by priority, got: %v", ids)
+			}
+			if len(set.Enabled()) != 2 {
+				t.Fatalf("expected 2 enabled rules, got: %v", len(set.Enabled()))
+			}
+			hash, ok := set.Get("hash")
+			if !ok || hash.Description != "hash passwords" {
+				t.Fatalf("expected hash rule, got: %v", hash)
+			}
+			patch, err := hash.Trigger.Trigger(map[string]interface{}{
+				"event":    "signup",
+				"password": "123456",
+			})
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if patch["password"] != "7c4a8d09ca3762af61e59520943dc26494f8941b" {
+				t.Fatalf("unexpected patch: %v", patch)
+			}
+		})
+	}
+}
+
+func TestLoadRuleSet_Errors(t *testing.T) {
+	tests := []struct {
+		name   string
+		format trigger.RuleFormat
+		opts   []trigger.EnvOption
+		src    string
+		want   []string
+	}{
+		{
+			name:   "json",
+			format: trigger.RuleFormatJSON,
+			src: `{
+  "rules": [
+    {"id": "a", "decision": "this.x ==", "mutation": "{'y': 1}"},
+    {"id": "b", "decision": "true", "mutation": "{'y': undefined_var}"},
+    {"id": "a", "decision": "true", "mutation": "{'y': 1}"}
+  ]
+}`,
+			want: []string{"rules.json:3:39: rule a:", "rules.json:4:56: rule b:", "rules.json:5:5: rule a: duplicate rule id"},
+		},
+		{
+			name:   "yaml",
+			format: trigger.RuleFormatYAML,
+			src: `rules:
+  - id: a
+    decision: this.x ==
+    mutation: "{'y': 1}"
+  - id: b
+    decision: "true"
+    mutation: |
+      {
+        'y': undefined_var
+      }
+`,
+			want: []string{"rules.yaml:3:24: rule a:", "rules.yaml:9:14: rule b:"},
+		},
+		{
+			name:   "hcl",
+			format: trigger.RuleFormatHCL,
+			src: `rule "a" {
+  decision = "this.x =="
+  mutation = "{'y': 1}"
+}
+
+rule "b" {
+  mutation = "{'y': 1}"
+}
+`,
+			want: []string{"rules.hcl:2:24: rule a:", "rules.hcl:6:1: rule b: missing decision"},
+		},
+		{
+			name:   "cost",
+			format: trigger.RuleFormatYAML,
+			opts:   []trigger.EnvOption{trigger.WithMaxEstimatedCost(100)},
+			src: `rules:
+  - id: a
+    decision: "[this.x, this.y].exists(v, v == 1)"
+    mutation: "{'y': 1}"
+`,
+			want: []string{"rules.yaml:3:16: rule a: estimated max cost of ([this.x, this.y].exists(v, v == 1))"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env, err := trigger.NewEnv(tt.opts...)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			_, err = env.LoadRuleSet(strings.NewReader(tt.src), tt.format)
+			setErr, ok := err.(*trigger.RuleSetError)
+			if !ok {
+				t.Fatalf("expected a rule set error, got: %v", err)
+			}
+			if len(setErr.Errors) != len(tt.want) {
+				t.Fatalf("expected %v errors, got: %v", len(tt.want), setErr.Error())
+			}
+			for i, want := range tt.want {
+				setErr.Errors[i].File = "rules." + tt.format.String()
+				if got := setErr.Errors[i].Error(); !strings.HasPrefix(got, want) {
+					t.Fatalf("expected error starting with %q, got: %q", want, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,562 @@
+package trigger
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/google/cel-go/checker/decls"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/dynamicpb"
+	_ "google.golang.org/protobuf/types/known/structpb"
+	_ "google.golang.org/protobuf/types/known/timestamppb"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrInvalidSchema = errors.New("trigger: invalid schema")
+
+// Schema describes the shape of an input variable so that expressions referencing unknown fields or
+// mismatched types fail to compile. Schemas are backed by protobuf message descriptors.
+type Schema struct {
+	message protoreflect.MessageDescriptor
+	newFunc func() proto.Message
+	file    protoreflect.FileDescriptor
+	typ     proto.Message
+}
+
+// Type returns the CEL type of the schema
+func (s *Schema) Type() *expr.Type {
+	return decls.NewObjectType(string(s.message.FullName()))
+}
+
+// convert converts a map or struct input into a message of the schema's type. Fields that are not part of the schema
+// are discarded.
+func (s *Schema) convert(value interface{}) (interface{}, error) {
+	if !convertible(value) {
+		return value, nil
+	}
+	bits, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to convert input to %s", s.message.FullName())
+	}
+	msg := s.newFunc()
+	if err := (protojson.UnmarshalOptions{DiscardUnknown: true}).Unmarshal(bits, msg); err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to convert input to %s", s.message.FullName())
+	}
+	return msg, nil
+}
+
+// convertible returns true if the value is a map or a struct (or pointer to one) that isn't a protobuf message
+func convertible(value interface{}) bool {
+	switch value.(type) {
+	case map[string]interface{}:
+		return true
+	case proto.Message:
+		return false
+	}
+	rv := reflect.ValueOf(value)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	return rv.Kind() == reflect.Struct
+}
+
+// NewProtoSchema creates a Schema from a protobuf message type
+func NewProtoSchema(msg proto.Message) *Schema {
+	return &Schema{
+		message: msg.ProtoReflect().Descriptor(),
+		newFunc: func() proto.Message {
+			return msg.ProtoReflect().New().Interface()
+		},
+		typ: msg,
+	}
+}
+
+// NewStructSchema creates a Schema from a Go struct. Fields are named after their json tags & the fields of embedded
+// structs are promoted like encoding/json does.
+func NewStructSchema(v interface{}) (*Schema, error) {
+	typ := reflect.TypeOf(v)
+	for typ != nil && typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == nil || typ.Kind() != reflect.Struct {
+		return nil, errors.Wrapf(ErrInvalidSchema, "expected a struct, got %T", v)
+	}
+	node, err := structNode(typ, map[reflect.Type]bool{})
+	if err != nil {
+		return nil, err
+	}
+	return newSynthesizedSchema(node)
+}
+
+// NewJSONSchema creates a Schema from a JSON Schema document. The document must describe an object.
+// Supported keywords: title, type, properties, items & additionalProperties.
+func NewJSONSchema(document []byte) (*Schema, error) {
+	var doc jsonSchema
+	if err := json.Unmarshal(document, &doc); err != nil {
+		return nil, errors.Wrap(ErrInvalidSchema, err.Error())
+	}
+	if doc.Type != "object" {
+		return nil, errors.Wrapf(ErrInvalidSchema, "expected type object, got %q", doc.Type)
+	}
+	name := doc.Title
+	if name == "" {
+		name = "Schema"
+	}
+	node, err := jsonNode(name, &doc)
+	if err != nil {
+		return nil, err
+	}
+	return newSynthesizedSchema(node)
+}
+
+type schemaKind int
+
+const (
+	kindScalar schemaKind = iota
+	kindMessage
+	kindList
+	kindMap
+	kindDyn
+	kindTimestamp
+)
+
+type schemaNode struct {
+	kind   schemaKind
+	scalar descriptorpb.FieldDescriptorProto_Type
+	name   string
+	fields []*schemaField
+	elem   *schemaNode
+}
+
+type schemaField struct {
+	name string
+	node *schemaNode
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func structNode(typ reflect.Type, seen map[reflect.Type]bool) (*schemaNode, error) {
+	if seen[typ] {
+		return nil, errors.Wrapf(ErrInvalidSchema, "recursive struct %s", typ)
+	}
+	seen[typ] = true
+	defer delete(seen, typ)
+	node := &schemaNode{
+		kind: kindMessage,
+		name: typ.Name(),
+	}
+	for _, field := range jsonFields(typ) {
+		fieldNode, err := typeNode(field.typ, seen)
+		if err != nil {
+			return nil, errors.Wrapf(err, "%s.%s", typ.Name(), field.name)
+		}
+		node.fields = append(node.fields, &schemaField{
+			name: field.name,
+			node: fieldNode,
+		})
+	}
+	return node, nil
+}
+
+// jsonField is a field of a struct as it's encoded by encoding/json
+type jsonField struct {
+	name   string
+	typ    reflect.Type
+	depth  int
+	tagged bool
+}
+
+// jsonFields returns the fields encoding/json encodes for the struct type. The fields of embedded structs without a
+// json name are promoted into the struct. Like encoding/json, the shallowest of the fields sharing a name wins, then
+// the tagged one, & fields that are still ambiguous are dropped.
+func jsonFields(typ reflect.Type) []jsonField {
+	var (
+		fields []jsonField
+		walk   func(typ reflect.Type, depth int, path map[reflect.Type]bool)
+	)
+	walk = func(typ reflect.Type, depth int, path map[reflect.Type]bool) {
+		if path[typ] {
+			return
+		}
+		path[typ] = true
+		defer delete(path, typ)
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			fieldType := field.Type
+			if fieldType.Kind() == reflect.Ptr {
+				fieldType = fieldType.Elem()
+			}
+			if field.Anonymous {
+				// the exported fields of an embedded unexported struct are still encoded, unless it's a pointer
+				if field.PkgPath != "" && (field.Type.Kind() == reflect.Ptr || fieldType.Kind() != reflect.Struct) {
+					continue
+				}
+			} else if field.PkgPath != "" {
+				continue
+			}
+			tag := field.Tag.Get("json")
+			if tag == "-" {
+				continue
+			}
+			name := strings.Split(tag, ",")[0]
+			if name == "" && field.Anonymous && fieldType.Kind() == reflect.Struct {
+				walk(fieldType, depth+1, path)
+				continue
+			}
+			tagged := name != ""
+			if !tagged {
+				name = field.Name
+			}
+			fields = append(fields, jsonField{
+				name:   name,
+				typ:    field.Type,
+				depth:  depth,
+				tagged: tagged,
+			})
+		}
+	}
+	walk(typ, 0, map[reflect.Type]bool{})
+	named := map[string][]jsonField{}
+	var names []string
+	for _, field := range fields {
+		if _, ok := named[field.name]; !ok {
+			names = append(names, field.name)
+		}
+		named[field.name] = append(named[field.name], field)
+	}
+	var dominant []jsonField
+	for _, name := range names {
+		if field, ok := dominantField(named[name]); ok {
+			dominant = append(dominant, field)
+		}
+	}
+	return dominant
+}
+
+// dominantField returns the field encoding/json encodes of the fields sharing a name. ok is false if it's ambiguous.
+func dominantField(fields []jsonField) (jsonField, bool) {
+	depth := fields[0].depth
+	for _, field := range fields {
+		if field.depth < depth {
+			depth = field.depth
+		}
+	}
+	var shallowest, tagged []jsonField
+	for _, field := range fields {
+		if field.depth == depth {
+			shallowest = append(shallowest, field)
+			if field.tagged {
+				tagged = append(tagged, field)
+			}
+		}
+	}
+	switch {
+	case len(shallowest) == 1:
+		return shallowest[0], true
+	case len(tagged) == 1:
+		return tagged[0], true
+	}
+	return jsonField{}, false
+}
+
+func typeNode(typ reflect.Type, seen map[reflect.Type]bool) (*schemaNode, error) {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ == timeType {
+		return &schemaNode{kind: kindTimestamp}, nil
+	}
+	switch typ.Kind() {
+	case reflect.String:
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_STRING}, nil
+	case reflect.Bool:
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_BOOL}, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_INT64}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_UINT64}, nil
+	case reflect.Float32, reflect.Float64:
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE}, nil
+	case reflect.Interface:
+		return &schemaNode{kind: kindDyn}, nil
+	case reflect.Struct:
+		return structNode(typ, seen)
+	case reflect.Slice, reflect.Array:
+		if typ.Elem().Kind() == reflect.Uint8 {
+			return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_BYTES}, nil
+		}
+		elem, err := typeNode(typ.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: kindList, elem: elem}, nil
+	case reflect.Map:
+		if typ.Key().Kind() != reflect.String {
+			return nil, errors.Wrapf(ErrInvalidSchema, "unsupported map key type %s", typ.Key())
+		}
+		elem, err := typeNode(typ.Elem(), seen)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: kindMap, elem: elem}, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidSchema, "unsupported type %s", typ)
+	}
+}
+
+type jsonSchema struct {
+	Title                string                 `json:"title"`
+	Type                 string                 `json:"type"`
+	Format               string                 `json:"format"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Items                *jsonSchema            `json:"items"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+}
+
+func jsonNode(name string, doc *jsonSchema) (*schemaNode, error) {
+	switch doc.Type {
+	case "string":
+		if doc.Format == "date-time" {
+			return &schemaNode{kind: kindTimestamp}, nil
+		}
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_STRING}, nil
+	case "boolean":
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_BOOL}, nil
+	case "integer":
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_INT64}, nil
+	case "number":
+		return &schemaNode{kind: kindScalar, scalar: descriptorpb.FieldDescriptorProto_TYPE_DOUBLE}, nil
+	case "", "null":
+		return &schemaNode{kind: kindDyn}, nil
+	case "array":
+		if doc.Items == nil {
+			return &schemaNode{kind: kindList, elem: &schemaNode{kind: kindDyn}}, nil
+		}
+		elem, err := jsonNode(name, doc.Items)
+		if err != nil {
+			return nil, err
+		}
+		return &schemaNode{kind: kindList, elem: elem}, nil
+	case "object":
+		if len(doc.Properties) == 0 {
+			var additional jsonSchema
+			if len(doc.AdditionalProperties) > 0 && json.Unmarshal(doc.AdditionalProperties, &additional) == nil && additional.Type != "" {
+				elem, err := jsonNode(name, &additional)
+				if err != nil {
+					return nil, err
+				}
+				return &schemaNode{kind: kindMap, elem: elem}, nil
+			}
+			return &schemaNode{kind: kindMap, elem: &schemaNode{kind: kindDyn}}, nil
+		}
+		node := &schemaNode{
+			kind: kindMessage,
+			name: name,
+		}
+		for _, property := range sortedKeys(doc.Properties) {
+			child := doc.Properties[property]
+			childName := child.Title
+			if childName == "" {
+				childName = name + strings.Title(property)
+			}
+			fieldNode, err := jsonNode(childName, child)
+			if err != nil {
+				return nil, errors.Wrap(err, property)
+			}
+			node.fields = append(node.fields, &schemaField{
+				name: property,
+				node: fieldNode,
+			})
+		}
+		return node, nil
+	default:
+		return nil, errors.Wrapf(ErrInvalidSchema, "unsupported type %q", doc.Type)
+	}
+}
+
+var identifier = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+type schemaBuilder struct {
+	pkg   string
+	file  *descriptorpb.FileDescriptorProto
+	names map[string]int
+}
+
+var (
+	schemaPackagesMu sync.Mutex
+	schemaPackages   = map[string]int{}
+)
+
+// schemaPackage returns a unique package for a synthesized schema so schemas with the same name, ex: a struct & a JSON
+// Schema titled User, describe different types
+func schemaPackage(name string) string {
+	schemaPackagesMu.Lock()
+	defer schemaPackagesMu.Unlock()
+	pkg := fmt.Sprintf("trigger.schema.%s", strings.ToLower(name))
+	schemaPackages[pkg]++
+	if count := schemaPackages[pkg]; count > 1 {
+		// names are identifiers so the extra segment can't collide with another schema's package
+		pkg = fmt.Sprintf("%s.s%d", pkg, count)
+	}
+	return pkg
+}
+
+func newSynthesizedSchema(node *schemaNode) (*Schema, error) {
+	if !identifier.MatchString(node.name) {
+		return nil, errors.Wrapf(ErrInvalidSchema, "invalid name %q", node.name)
+	}
+	pkg := schemaPackage(node.name)
+	b := &schemaBuilder{
+		pkg: pkg,
+		file: &descriptorpb.FileDescriptorProto{
+			Name:    proto.String(strings.Replace(pkg, ".", "/", -1) + ".proto"),
+			Package: proto.String(pkg),
+			Syntax:  proto.String("proto3"),
+		},
+		names: map[string]int{},
+	}
+	fullName, err := b.message(node)
+	if err != nil {
+		return nil, err
+	}
+	file, err := protodesc.NewFile(b.file, protoregistry.GlobalFiles)
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidSchema, err.Error())
+	}
+	message := file.Messages().ByName(protoreflect.FullName(fullName).Name())
+	return &Schema{
+		message: message,
+		newFunc: func() proto.Message {
+			return dynamicpb.NewMessage(message)
+		},
+		file: file,
+	}, nil
+}
+
+func (b *schemaBuilder) message(node *schemaNode) (string, error) {
+	name := node.name
+	if name == "" || !identifier.MatchString(name) {
+		name = "Message"
+	}
+	if count := b.names[name]; count > 0 {
+		b.names[name]++
+		name = fmt.Sprintf("%s%d", name, count)
+	} else {
+		b.names[name] = 1
+	}
+	fullName := fmt.Sprintf("%s.%s", b.pkg, name)
+	msg := &descriptorpb.DescriptorProto{
+		Name: proto.String(name),
+	}
+	b.file.MessageType = append(b.file.MessageType, msg)
+	for i, field := range node.fields {
+		if !identifier.MatchString(field.name) {
+			return "", errors.Wrapf(ErrInvalidSchema, "invalid field name %q", field.name)
+		}
+		fd := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String(field.name),
+			JsonName: proto.String(field.name),
+			Number:   proto.Int32(int32(i + 1)),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if err := b.field(msg, fullName, fd, field.node); err != nil {
+			return "", err
+		}
+		msg.Field = append(msg.Field, fd)
+	}
+	return fullName, nil
+}
+
+func (b *schemaBuilder) field(msg *descriptorpb.DescriptorProto, msgName string, fd *descriptorpb.FieldDescriptorProto, node *schemaNode) error {
+	switch node.kind {
+	case kindScalar:
+		fd.Type = node.scalar.Enum()
+	case kindDyn:
+		b.dependency("google/protobuf/struct.proto")
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fd.TypeName = proto.String(".google.protobuf.Value")
+	case kindTimestamp:
+		b.dependency("google/protobuf/timestamp.proto")
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fd.TypeName = proto.String(".google.protobuf.Timestamp")
+	case kindMessage:
+		name, err := b.message(node)
+		if err != nil {
+			return err
+		}
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fd.TypeName = proto.String("." + name)
+	case kindList:
+		elem := node.elem
+		if elem.kind == kindList || elem.kind == kindMap {
+			elem = &schemaNode{kind: kindDyn}
+		}
+		if err := b.field(msg, msgName, fd, elem); err != nil {
+			return err
+		}
+		fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+	case kindMap:
+		elem := node.elem
+		if elem.kind == kindList || elem.kind == kindMap {
+			elem = &schemaNode{kind: kindDyn}
+		}
+		entryName := strings.Replace(strings.Title(strings.Replace(fd.GetName(), "_", " ", -1)), " ", "", -1) + "Entry"
+		entry := &descriptorpb.DescriptorProto{
+			Name:    proto.String(entryName),
+			Options: &descriptorpb.MessageOptions{MapEntry: proto.Bool(true)},
+			Field: []*descriptorpb.FieldDescriptorProto{
+				{
+					Name:     proto.String("key"),
+					JsonName: proto.String("key"),
+					Number:   proto.Int32(1),
+					Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+					Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+				},
+			},
+		}
+		value := &descriptorpb.FieldDescriptorProto{
+			Name:     proto.String("value"),
+			JsonName: proto.String("value"),
+			Number:   proto.Int32(2),
+			Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		}
+		if err := b.field(entry, msgName+"."+entryName, value, elem); err != nil {
+			return err
+		}
+		entry.Field = append(entry.Field, value)
+		msg.NestedType = append(msg.NestedType, entry)
+		fd.Label = descriptorpb.FieldDescriptorProto_LABEL_REPEATED.Enum()
+		fd.Type = descriptorpb.FieldDescriptorProto_TYPE_MESSAGE.Enum()
+		fd.TypeName = proto.String("." + msgName + "." + entryName)
+	}
+	return nil
+}
+
+func (b *schemaBuilder) dependency(file string) {
+	for _, dep := range b.file.Dependency {
+		if dep == file {
+			return
+		}
+	}
+	b.file.Dependency = append(b.file.Dependency, file)
+}
+
+func sortedKeys(m map[string]*jsonSchema) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,198 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"testing"
+)
+
+type user struct {
+	Name   string            `json:"name"`
+	Email  string            `json:"email"`
+	Age    int               `json:"age"`
+	Roles  []string          `json:"roles"`
+	Labels map[string]string `json:"labels"`
+	Org    struct {
+		Name string `json:"name"`
+	} `json:"org"`
+}
+
+type base struct {
+	ID      string `json:"id"`
+	Created string `json:"created"`
+}
+
+type account struct {
+	base
+	Name    string `json:"name"`
+	Created int    `json:"created"`
+}
+
+func TestNewStructSchema_Embedded(t *testing.T) {
+	schema, err := trigger.NewStructSchema(&account{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env, err := trigger.NewEnv(trigger.WithSchema("this", schema))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := env.NewDecision("this.base.id == 'x'"); err == nil {
+		t.Fatal("expected embedded struct fields to be promoted")
+	}
+	decision, err := env.NewDecision("this.id == 'x' && this.name == 'acme' && this.created == 1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	a := account{Name: "acme", Created: 1}
+	a.ID = "x"
+	for _, input := range []interface{}{
+		a,
+		&a,
+		map[string]interface{}{"id": "x", "name": "acme", "created": 1},
+	} {
+		if err := decision.EvalVars(map[string]interface{}{
+			"this": input,
+		}); err != nil {
+			t.Fatalf("%T: %s", input, err.Error())
+		}
+	}
+}
+
+func TestNewStructSchema(t *testing.T) {
+	schema, err := trigger.NewStructSchema(user{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env, err := trigger.NewEnv(trigger.WithSchema("this", schema))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = env.NewDecision("this.name == 'bob' &&\n this.emial.endsWith('acme.com')")
+	if err == nil {
+		t.Fatal("expected unknown field to fail compilation")
+	}
+	compileErr, ok := err.(*trigger.CompileError)
+	if !ok {
+		t.Fatalf("expected a compile error, got %T", err)
+	}
+	if len(compileErr.Issues) != 1 || compileErr.Issues[0].Line != 2 {
+		t.Fatalf("unexpected issues: %v", compileErr.Issues)
+	}
+	if _, err := env.NewDecision("this.age == 'ten'"); err == nil {
+		t.Fatal("expected type mismatch to fail compilation")
+	}
+	decision, err := env.NewDecision("this.email.endsWith('acme.com') && this.age > 18 && 'admin' in this.roles && this.org.name == 'acme' && this.labels['tier'] == 'gold'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.Eval(map[string]interface{}{
+		"name":     "bob",
+		"email":    "bob@acme.com",
+		"age":      30,
+		"roles":    []string{"admin"},
+		"labels":   map[string]string{"tier": "gold"},
+		"org":      map[string]interface{}{"name": "acme"},
+		"password": "123456",
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+	trigg, err := env.NewTrigger(decision, "{'name': this.name.upperCase()}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	data, err := trigg.Trigger(map[string]interface{}{
+		"name":   "bob",
+		"email":  "bob@acme.com",
+		"age":    30,
+		"roles":  []string{"admin"},
+		"labels": map[string]string{"tier": "gold"},
+		"org":    map[string]interface{}{"name": "acme"},
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if data["name"] != "BOB" {
+		t.Fatalf("expected BOB, got %v", data["name"])
+	}
+	u := user{
+		Name:   "bob",
+		Email:  "bob@acme.com",
+		Age:    30,
+		Roles:  []string{"admin"},
+		Labels: map[string]string{"tier": "gold"},
+	}
+	u.Org.Name = "acme"
+	for _, input := range []interface{}{u, &u} {
+		if err := decision.EvalVars(map[string]interface{}{
+			"this": input,
+		}); err != nil {
+			t.Fatalf("%T: %s", input, err.Error())
+		}
+	}
+}
+
+func TestNewJSONSchema(t *testing.T) {
+	schema, err := trigger.NewJSONSchema([]byte(`{
+	"title": "User",
+	"type": "object",
+	"properties": {
+		"email": {"type": "string"},
+		"age": {"type": "integer"},
+		"created_at": {"type": "string", "format": "date-time"},
+		"meta": {"type": "object"}
+	}
+}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env, err := trigger.NewEnv(trigger.WithSchema("this", schema))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := env.NewDecision("this.emial == 'bob@acme.com'"); err == nil {
+		t.Fatal("expected unknown field to fail compilation")
+	}
+	decision, err := env.NewDecision("this.email == 'bob@acme.com' && this.age >= 30 && this.meta.source == 'web'")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.Eval(map[string]interface{}{
+		"email":      "bob@acme.com",
+		"age":        30,
+		"created_at": "2020-12-01T00:00:00Z",
+		"meta":       map[string]interface{}{"source": "web"},
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func TestSchema_SameName(t *testing.T) {
+	structSchema, err := trigger.NewStructSchema(user{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	jsonSchema, err := trigger.NewJSONSchema([]byte(`{
+	"title": "user",
+	"type": "object",
+	"properties": {
+		"x": {"type": "integer"}
+	}
+}`))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	env, err := trigger.NewEnv(trigger.WithSchema("this", structSchema), trigger.WithSchema("other", jsonSchema))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	decision, err := env.NewDecision("this.name == 'bob' && other.x > 1")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := decision.EvalVars(map[string]interface{}{
+		"this":  map[string]interface{}{"name": "bob"},
+		"other": map[string]interface{}{"x": 2},
+	}); err != nil {
+		t.Fatal(err.Error())
+	}
+}
@@ -0,0 +1,356 @@
+package trigger
+
+import (
+	"fmt"
+	"github.com/google/cel-go/common/operators"
+	"github.com/pkg/errors"
+	expr "google.golang.org/genproto/googleapis/api/expr/v1alpha1"
+	"strings"
+)
+
+var ErrSQLUnsupported = errors.New("trigger: expression cannot be translated to sql")
+
+// SQLDialect determines the placeholder, identifier quoting & regular expression syntax of generated sql
+type SQLDialect int
+
+const (
+	// SQLDialectPostgres uses $1 placeholders, "double quoted" identifiers & the ~ regex operator
+	SQLDialectPostgres SQLDialect = iota
+	// SQLDialectMySQL uses ? placeholders, `backtick quoted` identifiers & the REGEXP operator
+	SQLDialectMySQL
+	// SQLDialectSQLite uses ? placeholders, "double quoted" identifiers & the REGEXP operator
+	SQLDialectSQLite
+)
+
+type sqlOptions struct {
+	dialect SQLDialect
+	columns func(path []string) (string, error)
+}
+
+// SQLOption configures the translation of a Decision into sql
+type SQLOption func(o *sqlOptions)
+
+// WithSQLDialect sets the sql dialect (default: SQLDialectPostgres)
+func WithSQLDialect(dialect SQLDialect) SQLOption {
+	return func(o *sqlOptions) {
+		o.dialect = dialect
+	}
+}
+
+// WithSQLColumns sets the function that maps a field path, ex: [this email], to a column expression. The returned
+// column expression is inserted into the sql as-is. By default, this.${column} is mapped to the quoted column name &
+// any other path is unsupported.
+func WithSQLColumns(columns func(path []string) (string, error)) SQLOption {
+	return func(o *sqlOptions) {
+		o.columns = columns
+	}
+}
+
+// ToSQL translates the decision into a parameterized sql WHERE clause & it's arguments. Supported constructs are:
+// ==, !=, <, <=, >, >=, in (constant lists), &&, ||, !, has(), startsWith, endsWith, contains & matches.
+// Any other construct returns an error wrapping ErrSQLUnsupported.
+func (n *Decision) ToSQL(opts ...SQLOption) (string, []interface{}, error) {
+	options := &sqlOptions{}
+	for _, o := range opts {
+		o(options)
+	}
+	if options.columns == nil {
+		options.columns = options.defaultColumns
+	}
+	s := &sqlBuilder{
+		options: options,
+	}
+	where, err := s.predicate(n.ast.Expr())
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "trigger: failed to translate decision (%s)", n.expression)
+	}
+	return where, s.args, nil
+}
+
+func (o *sqlOptions) defaultColumns(path []string) (string, error) {
+	if len(path) != 2 || path[0] != "this" {
+		return "", errors.Wrapf(ErrSQLUnsupported, "field %s", strings.Join(path, "."))
+	}
+	return o.quote(path[1]), nil
+}
+
+func (o *sqlOptions) quote(identifier string) string {
+	if o.dialect == SQLDialectMySQL {
+		return fmt.Sprintf("`%s`", strings.Replace(identifier, "`", "``", -1))
+	}
+	return fmt.Sprintf(`"%s"`, strings.Replace(identifier, `"`, `""`, -1))
+}
+
+type sqlBuilder struct {
+	options *sqlOptions
+	args    []interface{}
+}
+
+func (s *sqlBuilder) arg(value interface{}) string {
+	s.args = append(s.args, value)
+	if s.options.dialect == SQLDialectPostgres {
+		return fmt.Sprintf("$%d", len(s.args))
+	}
+	return "?"
+}
+
+var sqlComparisons = map[string]string{
+	operators.Equals:        "=",
+	operators.NotEquals:     "<>",
+	operators.Less:          "<",
+	operators.LessEquals:    "<=",
+	operators.Greater:       ">",
+	operators.GreaterEquals: ">=",
+}
+
+// flipped holds the comparison to use when the operands are swapped so the column is on the left
+var flipped = map[string]string{
+	"=":  "=",
+	"<>": "<>",
+	"<":  ">",
+	"<=": ">=",
+	">":  "<",
+	">=": "<=",
+}
+
+// predicate translates a boolean expression
+func (s *sqlBuilder) predicate(e *expr.Expr) (string, error) {
+	switch k := e.GetExprKind().(type) {
+	case *expr.Expr_ConstExpr:
+		if val, ok := k.ConstExpr.GetConstantKind().(*expr.Constant_BoolValue); ok {
+			if val.BoolValue {
+				return "1 = 1", nil
+			}
+			return "1 = 0", nil
+		}
+	case *expr.Expr_SelectExpr:
+		column, err := s.column(e)
+		if err != nil {
+			return "", err
+		}
+		if k.SelectExpr.GetTestOnly() {
+			return fmt.Sprintf("%s IS NOT NULL", column), nil
+		}
+		return fmt.Sprintf("%s = %s", column, s.arg(true)), nil
+	case *expr.Expr_CallExpr:
+		return s.call(k.CallExpr)
+	}
+	return "", errors.Wrapf(ErrSQLUnsupported, "expression %s", exprKind(e))
+}
+
+func (s *sqlBuilder) call(call *expr.Expr_Call) (string, error) {
+	args := call.GetArgs()
+	switch fn := call.GetFunction(); fn {
+	case operators.LogicalAnd, operators.LogicalOr:
+		lhs, err := s.predicate(args[0])
+		if err != nil {
+			return "", err
+		}
+		rhs, err := s.predicate(args[1])
+		if err != nil {
+			return "", err
+		}
+		op := "AND"
+		if fn == operators.LogicalOr {
+			op = "OR"
+		}
+		return fmt.Sprintf("(%s %s %s)", lhs, op, rhs), nil
+	case operators.LogicalNot:
+		operand, err := s.predicate(args[0])
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("NOT (%s)", operand), nil
+	case operators.Equals, operators.NotEquals, operators.Less, operators.LessEquals, operators.Greater, operators.GreaterEquals:
+		op := sqlComparisons[fn]
+		lhs, rhs := args[0], args[1]
+		if !isField(lhs) && isField(rhs) {
+			lhs, rhs = rhs, lhs
+			op = flipped[op]
+		}
+		column, err := s.column(lhs)
+		if err != nil {
+			return "", err
+		}
+		if isNull(rhs) {
+			switch op {
+			case "=":
+				return fmt.Sprintf("%s IS NULL", column), nil
+			case "<>":
+				return fmt.Sprintf("%s IS NOT NULL", column), nil
+			}
+		}
+		value, err := s.operand(rhs)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%s %s %s", column, op, value), nil
+	case operators.In, operators.OldIn:
+		column, err := s.column(args[0])
+		if err != nil {
+			return "", err
+		}
+		list := args[1].GetListExpr()
+		if list == nil {
+			return "", errors.Wrap(ErrSQLUnsupported, "in operator requires a constant list")
+		}
+		if len(list.GetElements()) == 0 {
+			return "1 = 0", nil
+		}
+		var values []string
+		for _, elem := range list.GetElements() {
+			value, err := constant(elem)
+			if err != nil {
+				return "", err
+			}
+			values = append(values, s.arg(value))
+		}
+		return fmt.Sprintf("%s IN (%s)", column, strings.Join(values, ", ")), nil
+	case "startsWith", "endsWith", "contains":
+		if call.GetTarget() == nil || len(args) != 1 {
+			break
+		}
+		column, err := s.column(call.GetTarget())
+		if err != nil {
+			return "", err
+		}
+		value, err := constant(args[0])
+		if err != nil {
+			return "", err
+		}
+		str, ok := value.(string)
+		if !ok {
+			break
+		}
+		pattern := escapeLike(str)
+		switch fn {
+		case "startsWith":
+			pattern = pattern + "%"
+		case "endsWith":
+			pattern = "%" + pattern
+		default:
+			pattern = "%" + pattern + "%"
+		}
+		escape := `'\'`
+		if s.options.dialect == SQLDialectMySQL {
+			// a backslash escapes the closing quote of a mysql string literal
+			escape = `'\\'`
+		}
+		return fmt.Sprintf(`%s LIKE %s ESCAPE %s`, column, s.arg(pattern), escape), nil
+	case "matches":
+		target := call.GetTarget()
+		if target == nil && len(args) == 2 {
+			target, args = args[0], args[1:]
+		}
+		if target == nil || len(args) != 1 {
+			break
+		}
+		column, err := s.column(target)
+		if err != nil {
+			return "", err
+		}
+		value, err := constant(args[0])
+		if err != nil {
+			return "", err
+		}
+		if s.options.dialect == SQLDialectPostgres {
+			return fmt.Sprintf("%s ~ %s", column, s.arg(value)), nil
+		}
+		return fmt.Sprintf("%s REGEXP %s", column, s.arg(value)), nil
+	}
+	return "", errors.Wrapf(ErrSQLUnsupported, "function %s", call.GetFunction())
+}
+
+// operand translates the right hand side of a comparison into a column or a placeholder
+func (s *sqlBuilder) operand(e *expr.Expr) (string, error) {
+	if isField(e) {
+		return s.column(e)
+	}
+	value, err := constant(e)
+	if err != nil {
+		return "", err
+	}
+	return s.arg(value), nil
+}
+
+func (s *sqlBuilder) column(e *expr.Expr) (string, error) {
+	path, ok := fieldPath(e)
+	if !ok {
+		return "", errors.Wrapf(ErrSQLUnsupported, "expected a field, got %s", exprKind(e))
+	}
+	return s.options.columns(path)
+}
+
+// fieldPath returns the path of a field selection, ex: this.address.city = [this address city]
+func fieldPath(e *expr.Expr) ([]string, bool) {
+	switch k := e.GetExprKind().(type) {
+	case *expr.Expr_IdentExpr:
+		return []string{k.IdentExpr.GetName()}, true
+	case *expr.Expr_SelectExpr:
+		path, ok := fieldPath(k.SelectExpr.GetOperand())
+		if !ok {
+			return nil, false
+		}
+		return append(path, k.SelectExpr.GetField()), true
+	}
+	return nil, false
+}
+
+func isField(e *expr.Expr) bool {
+	_, ok := fieldPath(e)
+	return ok
+}
+
+func isNull(e *expr.Expr) bool {
+	_, ok := e.GetConstExpr().GetConstantKind().(*expr.Constant_NullValue)
+	return ok
+}
+
+// constant returns the Go value of a constant expression
+func constant(e *expr.Expr) (interface{}, error) {
+	c := e.GetConstExpr()
+	if c == nil {
+		return nil, errors.Wrapf(ErrSQLUnsupported, "expected a constant, got %s", exprKind(e))
+	}
+	switch k := c.GetConstantKind().(type) {
+	case *expr.Constant_StringValue:
+		return k.StringValue, nil
+	case *expr.Constant_Int64Value:
+		return k.Int64Value, nil
+	case *expr.Constant_Uint64Value:
+		return k.Uint64Value, nil
+	case *expr.Constant_DoubleValue:
+		return k.DoubleValue, nil
+	case *expr.Constant_BoolValue:
+		return k.BoolValue, nil
+	case *expr.Constant_BytesValue:
+		return k.BytesValue, nil
+	case *expr.Constant_NullValue:
+		return nil, nil
+	}
+	return nil, errors.Wrapf(ErrSQLUnsupported, "constant %T", c.GetConstantKind())
+}
+
+func exprKind(e *expr.Expr) string {
+	switch k := e.GetExprKind().(type) {
+	case *expr.Expr_ConstExpr:
+		return "constant"
+	case *expr.Expr_IdentExpr:
+		return fmt.Sprintf("identifier %s", k.IdentExpr.GetName())
+	case *expr.Expr_SelectExpr:
+		return "field selection"
+	case *expr.Expr_CallExpr:
+		return fmt.Sprintf("function %s", k.CallExpr.GetFunction())
+	case *expr.Expr_ListExpr:
+		return "list"
+	case *expr.Expr_StructExpr:
+		return "map"
+	case *expr.Expr_ComprehensionExpr:
+		return "comprehension"
+	}
+	return "unknown expression"
+}
+
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,89 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"github.com/pkg/errors"
+	"reflect"
+	"testing"
+)
+
+func TestDecision_ToSQL(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		opts       []trigger.SQLOption
+		where      string
+		args       []interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "equality & comparison",
+			expression: "this.name == 'bob' && 18 < this.age",
+			where:      `("name" = $1 AND "age" > $2)`,
+			args:       []interface{}{"bob", int64(18)},
+		},
+		{
+			name:       "in, not & or",
+			expression: "this.role in ['admin', 'owner'] || !(this.email.endsWith('@acme.com'))",
+			where:      `("role" IN ($1, $2) OR NOT ("email" LIKE $3 ESCAPE '\'))`,
+			args:       []interface{}{"admin", "owner", "%@acme.com"},
+		},
+		{
+			name:       "mysql like & regex",
+			expression: "this.name.startsWith('b_b') && this.email.matches('^.+@acme[.]com$') && this.deleted_at == null",
+			opts:       []trigger.SQLOption{trigger.WithSQLDialect(trigger.SQLDialectMySQL)},
+			where:      "((`name` LIKE ? ESCAPE '\\\\' AND `email` REGEXP ?) AND `deleted_at` IS NULL)",
+			args:       []interface{}{`b\_b%`, "^.+@acme[.]com$"},
+		},
+		{
+			name:       "mysql contains",
+			expression: `this.title.contains('50%') || this.title.endsWith('\\')`,
+			opts:       []trigger.SQLOption{trigger.WithSQLDialect(trigger.SQLDialectMySQL)},
+			where:      "(`title` LIKE ? ESCAPE '\\\\' OR `title` LIKE ? ESCAPE '\\\\')",
+			args:       []interface{}{`%50\%%`, `%\\`},
+		},
+		{
+			name:       "custom columns",
+			expression: "this.address.city.contains('york') && has(this.address.zip)",
+			opts: []trigger.SQLOption{trigger.WithSQLColumns(func(path []string) (string, error) {
+				return path[len(path)-1], nil
+			})},
+			where: "(city LIKE $1 ESCAPE '\\' AND zip IS NOT NULL)",
+			args:  []interface{}{"%york%"},
+		},
+		{
+			name:       "unsupported function",
+			expression: "this.password.sha1() == 'abc'",
+			wantErr:    true,
+		},
+		{
+			name:       "unsupported render",
+			expression: "this.render('{{ .name }}') == 'bob'",
+			wantErr:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			decision, err := trigger.NewDecision(tt.expression)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			where, args, err := decision.ToSQL(tt.opts...)
+			if tt.wantErr {
+				if errors.Cause(err) != trigger.ErrSQLUnsupported {
+					t.Fatalf("expected unsupported error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if where != tt.where {
+				t.Fatalf("ToSQL() where = %s, want %s", where, tt.where)
+			}
+			if !reflect.DeepEqual(args, tt.args) {
+				t.Fatalf("ToSQL() args = %v, want %v", args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,87 @@
+package trigger
+
+import (
+	"context"
+	"github.com/pkg/errors"
+)
+
+// DefaultCase is the case index returned by a SwitchTrigger when no case matched
+const DefaultCase = -1
+
+// SwitchTrigger holds ordered cases, each a decision & mutation, plus an optional default mutation. It executes the
+// mutation of the first case whose decision allows, ie: if A then patch1 else if B then patch2 else patch3.
+type SwitchTrigger struct {
+	cases    []*Trigger
+	fallback *Trigger
+}
+
+// NewSwitchTrigger creates a SwitchTrigger from the cases & an optional default mutation expression using the default Env
+func NewSwitchTrigger(defaultMutation string, cases ...*Trigger) (*SwitchTrigger, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewSwitchTrigger(defaultMutation, cases...)
+}
+
+// NewSwitchTrigger creates a SwitchTrigger from the cases & an optional default mutation expression. The default
+// mutation is executed if no case matches; an empty default mutation returns an empty patch. Cases must have a decision
+// & no else mutation since the default takes it's place.
+func (e *Env) NewSwitchTrigger(defaultMutation string, cases ...*Trigger) (*SwitchTrigger, error) {
+	s := &SwitchTrigger{}
+	for i, c := range cases {
+		if c.decision == nil {
+			return nil, errors.Errorf("trigger: switch case %v has no decision", i)
+		}
+		if c.otherwise != nil {
+			return nil, errors.Errorf("trigger: switch case %v has an else mutation", i)
+		}
+		s.cases = append(s.cases, c)
+	}
+	if defaultMutation != "" {
+		fallback, err := e.NewTrigger(nil, defaultMutation)
+		if err != nil {
+			return nil, errors.Wrap(err, "trigger: failed to create switch default")
+		}
+		s.fallback = fallback
+	}
+	return s, nil
+}
+
+// Cases returns the switch's cases in order
+func (s *SwitchTrigger) Cases() []*Trigger {
+	return append([]*Trigger{}, s.cases...)
+}
+
+// Trigger executes the mutation of the first case whose decision allows against the Mapper & returns it's patch
+// along with the case's index. If no case matches, the default mutation's patch & DefaultCase are returned.
+func (s *SwitchTrigger) Trigger(data map[string]interface{}) (map[string]interface{}, int, error) {
+	return s.TriggerContext(context.Background(), data)
+}
+
+// TriggerContext is like Trigger but evaluation is stopped once the context is done
+func (s *SwitchTrigger) TriggerContext(ctx context.Context, data map[string]interface{}) (map[string]interface{}, int, error) {
+	vars := map[string]interface{}{
+		"this": data,
+	}
+	for i, c := range s.cases {
+		out, err := c.eval(ctx, vars)
+		if err != nil {
+			return nil, i, errors.Wrapf(err, "trigger: failed to evaluate switch case %v", i)
+		}
+		if out != nil {
+			return toPatch(out), i, nil
+		}
+	}
+	if s.fallback == nil {
+		return map[string]interface{}{}, DefaultCase, nil
+	}
+	vars, err := s.fallback.env.vars(vars)
+	if err != nil {
+		return nil, DefaultCase, err
+	}
+	out, err := s.fallback.mutate(ctx, vars)
+	if err != nil {
+		return nil, DefaultCase, errors.Wrap(err, "trigger: failed to evaluate switch default")
+	}
+	return toPatch(out), DefaultCase, nil
+}
@@ -0,0 +1,44 @@
+package trigger_test
+
+import (
+	"github.com/graphikDB/trigger"
+	"reflect"
+	"testing"
+)
+
+func TestSwitchTrigger_Trigger(t *testing.T) {
+	s, err := trigger.NewSwitchTrigger("{'tier': 'bronze'}",
+		mustTrigger(t, "this.spend > 1000 => {'tier': 'gold'}"),
+		mustTrigger(t, "this.spend > 100 => {'tier': 'silver'}"),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	tests := []struct {
+		spend int
+		want  string
+		index int
+	}{
+		{spend: 5000, want: "gold", index: 0},
+		{spend: 500, want: "silver", index: 1},
+		{spend: 5, want: "bronze", index: trigger.DefaultCase},
+	}
+	for _, tt := range tests {
+		patch, index, err := s.Trigger(map[string]interface{}{
+			"spend": tt.spend,
+		})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if index != tt.index || !reflect.DeepEqual(patch, map[string]interface{}{"tier": tt.want}) {
+			t.Fatalf("expected case %v (%s), got: case %v %v", tt.index, tt.want, index, patch)
+		}
+	}
+	withElse, err := mustTrigger(t, "this.spend > 100 => {'tier': 'silver'}").WithElse("{'tier': 'none'}")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := trigger.NewSwitchTrigger("", withElse); err == nil {
+		t.Fatal("expected a case with an else mutation to be rejected")
+	}
+}
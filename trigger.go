@@ -1,66 +1,142 @@
 package trigger
 
 import (
+	"context"
 	"github.com/google/cel-go/cel"
 	"github.com/google/cel-go/common/types/ref"
 	"github.com/pkg/errors"
-	"strings"
 )
 
 // Trigger creates values as map[string]interface{} if it's decisider returns no errors against a Mapper
 type Trigger struct {
-	decision   *Decision
-	program    cel.Program
-	expression string
+	env             *Env
+	decision        *Decision
+	ast             *cel.Ast
+	program         cel.Program
+	expression      string
+	onDecisionError DecisionErrorPolicy
+	// otherwise is executed instead of the mutation if the decision denies
+	otherwise *Trigger
 }
 
-// NewTrigger creates a new trigger instance from the decision & trigger expressions
+// NewTrigger creates a new trigger instance from the decision & trigger expressions using the default Env
 func NewTrigger(decision *Decision, triggerExpression string) (*Trigger, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewTrigger(decision, triggerExpression)
+}
+
+// NewTrigger creates a new trigger instance from the decision & trigger expressions
+func (e *Env) NewTrigger(decision *Decision, triggerExpression string) (*Trigger, error) {
 	if triggerExpression == "" {
 		return nil, ErrEmptyExpressions
 	}
-	program, err := globalEnv.Program(triggerExpression)
+	c, err := e.compile(triggerExpression)
 	if err != nil {
 		return nil, err
 	}
+	_, max := estimateCost(c.program)
+	if decision != nil {
+		_, dMax := decision.EstimateCost()
+		max = addCost(max, dMax)
+	}
+	if err := e.checkCost(triggerExpression, max); err != nil {
+		return nil, err
+	}
 	return &Trigger{
-		decision:   decision,
-		program:    program,
-		expression: triggerExpression,
+		env:             e,
+		decision:        decision,
+		ast:             c.ast,
+		program:         c.program,
+		expression:      triggerExpression,
+		onDecisionError: e.onDecisionError,
 	}, nil
 }
 
 // Trigger executes it's decision against the Mapper and then overwrites the
 func (t *Trigger) Trigger(data map[string]interface{}) (map[string]interface{}, error) {
-	if err := t.decision.Eval(data); err == nil {
-		out, _, err := t.program.Eval(map[string]interface{}{
-			"this": data,
-		})
-		if err != nil {
-			return nil, errors.Wrapf(err, "trigger: failed to evaluate trigger (%s)", t.expression)
-		}
-		if patchFields, ok := out.Value().(map[ref.Val]ref.Val); ok {
-			newData := map[string]interface{}{}
-			for k, v := range patchFields {
-				newData[k.Value().(string)] = v.Value()
-			}
-			return newData, nil
-		}
-		if patchFields, ok := out.Value().(map[string]interface{}); ok {
-			return patchFields, nil
+	return t.EvalVars(map[string]interface{}{
+		"this": data,
+	})
+}
+
+// TriggerContext is like Trigger but evaluation is stopped once the context is done
+func (t *Trigger) TriggerContext(ctx context.Context, data map[string]interface{}) (map[string]interface{}, error) {
+	return t.evalVars(ctx, map[string]interface{}{
+		"this": data,
+	})
+}
+
+// EvalVars executes it's decision against the named input variables declared in the Env and then returns the
+// trigger's output
+func (t *Trigger) EvalVars(vars map[string]interface{}) (map[string]interface{}, error) {
+	return t.evalVars(context.Background(), vars)
+}
+
+func (t *Trigger) evalVars(ctx context.Context, vars map[string]interface{}) (map[string]interface{}, error) {
+	out, err := t.eval(ctx, vars)
+	if err != nil {
+		return nil, err
+	}
+	if out == nil {
+		return map[string]interface{}{}, nil
+	}
+	return toPatch(out), nil
+}
+
+// eval executes the trigger's decision & returns the trigger's raw output. A nil value is returned if the decision
+// denied or failed to evaluate & the trigger's DecisionErrorPolicy is DecisionErrorSkip.
+func (t *Trigger) eval(ctx context.Context, vars map[string]interface{}) (ref.Val, error) {
+	_, out, err := t.fire(ctx, vars)
+	return out, err
+}
+
+// mutate executes the trigger's expression without it's decision. vars must already be prepared by the Env.
+func (t *Trigger) mutate(ctx context.Context, vars map[string]interface{}) (ref.Val, error) {
+	ctrl := newControl(ctx, t.env.limits)
+	out, _, err := t.program.Eval(ctrl.activation(vars))
+	if ctrlErr := ctrl.err(); ctrlErr != nil {
+		return nil, errors.Wrapf(ctrlErr, "trigger: failed to evaluate trigger (%s)", t.expression)
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to evaluate trigger (%s)", t.expression)
+	}
+	if err := ctrl.checkOutput(out); err != nil {
+		return nil, errors.Wrapf(err, "trigger: failed to evaluate trigger (%s)", t.expression)
+	}
+	return out, nil
+}
+
+func toPatch(out ref.Val) map[string]interface{} {
+	if patch, ok := patchFields(out); ok {
+		return patch
+	}
+	return map[string]interface{}{
+		"value": out.Value(),
+	}
+}
+
+// patchFields returns the fields of a map output. ok is false if the output isn't a map.
+func patchFields(out ref.Val) (map[string]interface{}, bool) {
+	if patchFields, ok := out.Value().(map[ref.Val]ref.Val); ok {
+		newData := map[string]interface{}{}
+		for k, v := range patchFields {
+			newData[k.Value().(string)] = v.Value()
 		}
-		if patchFields, ok := out.Value().(map[string]string); ok {
-			newData := map[string]interface{}{}
-			for k, v := range patchFields {
-				newData[k] = v
-			}
-			return newData, nil
+		return newData, true
+	}
+	if patchFields, ok := out.Value().(map[string]interface{}); ok {
+		return patchFields, true
+	}
+	if patchFields, ok := out.Value().(map[string]string); ok {
+		newData := map[string]interface{}{}
+		for k, v := range patchFields {
+			newData[k] = v
 		}
-		return map[string]interface{}{
-			"value": out.Value(),
-		}, nil
+		return newData, true
 	}
-	return map[string]interface{}{}, nil
+	return nil, false
 }
 
 // Expression returns the triggers raw CEL expressions
@@ -68,25 +144,78 @@ func (e *Trigger) Expression() string {
 	return e.expression
 }
 
+// Decision returns the trigger's decision
+func (e *Trigger) Decision() *Decision {
+	return e.decision
+}
+
+// DecisionSource returns the raw CEL expression of the trigger's decision
+func (e *Trigger) DecisionSource() string {
+	if e.decision == nil {
+		return ""
+	}
+	return e.decision.expression
+}
+
+// MutationSource returns the raw CEL expression of the trigger's mutation
+func (e *Trigger) MutationSource() string {
+	return e.expression
+}
+
+// ElseSource returns the raw CEL expression of the trigger's else mutation or an empty string if it has none
+func (e *Trigger) ElseSource() string {
+	if e.otherwise == nil {
+		return ""
+	}
+	return e.otherwise.expression
+}
+
+// WithElse returns a copy of the trigger that executes the else expression if it's decision denies. The decision is
+// evaluated once, so exactly one of the mutations is executed. A decision that fails to evaluate executes neither.
+func (e *Trigger) WithElse(elseExpression string) (*Trigger, error) {
+	if e.decision == nil {
+		return nil, errors.New("trigger: else requires a decision")
+	}
+	otherwise, err := e.env.NewTrigger(nil, elseExpression)
+	if err != nil {
+		return nil, err
+	}
+	cpy := *e
+	cpy.otherwise = otherwise
+	_, max := cpy.EstimateCost()
+	if err := e.env.checkCost(elseExpression, max); err != nil {
+		return nil, err
+	}
+	return &cpy, nil
+}
+
 const ArrowOperator = "=>"
 
 var ErrArrowOperator = errors.Errorf("arrow operator: expecting syntax ${decision} %s ${mutation}", ArrowOperator)
 
-// NewArrowTrigger creates a trigger from arrow syntax  ${decision} => ${mutation}
+// NewArrowTrigger creates a trigger from arrow syntax  ${decision} => ${mutation} using the default Env
 func NewArrowTrigger(arrowExpression string) (*Trigger, error) {
-	split := strings.Split(arrowExpression, ArrowOperator)
-	if len(split) != 2 {
-		return nil, ErrArrowOperator
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewArrowTrigger(arrowExpression)
+}
+
+// NewArrowTrigger creates a trigger from arrow syntax  ${decision} => ${mutation}. The arrow operator may appear
+// within string literals & comments of either half. Syntax & compile errors are returned as an *ArrowError whose
+// positions are relative to the whole arrow expression.
+func (e *Env) NewArrowTrigger(arrowExpression string) (*Trigger, error) {
+	split, err := splitArrow(arrowExpression)
+	if err != nil {
+		return nil, err
 	}
-	decisionExp := split[0]
-	decision, err := NewDecision(decisionExp)
+	decision, err := e.NewDecision(split.decision.value)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create trigger from arrow expression")
+		return nil, arrowError(arrowExpression, "decision", split.decision, err)
 	}
-	triggerExp := split[1]
-	t, err := NewTrigger(decision, triggerExp)
+	t, err := e.NewTrigger(decision, split.mutation.value)
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create trigger from arrow expression")
+		return nil, arrowError(arrowExpression, "mutation", split.mutation, err)
 	}
 	return t, nil
 }
@@ -0,0 +1,313 @@
+package trigger
+
+import (
+	"github.com/pkg/errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ReloadEvent describes an attempt by a RuleSetWatcher to reload it's directory
+type ReloadEvent struct {
+	// Time is when the reload happened
+	Time time.Time
+	// Changed holds the paths of the files that were added, modified or removed
+	Changed []string
+	// RuleSet is the rule set served after the reload. It is the previous rule set if Err is not nil.
+	RuleSet *RuleSet
+	// Err is the reason the reload failed. It is a *RuleSetError if any rule failed to compile.
+	Err error
+}
+
+type watcherOptions struct {
+	interval time.Duration
+	onReload func(event ReloadEvent)
+}
+
+// WatcherOption configures a RuleSetWatcher
+type WatcherOption func(o *watcherOptions)
+
+// WithPollInterval sets how often the directory is checked for changes (default: 1 second)
+func WithPollInterval(interval time.Duration) WatcherOption {
+	return func(o *watcherOptions) {
+		o.interval = interval
+	}
+}
+
+// WithReloadHandler sets a function that is called after every reload attempt
+func WithReloadHandler(fn func(event ReloadEvent)) WatcherOption {
+	return func(o *watcherOptions) {
+		o.onReload = fn
+	}
+}
+
+// RuleSetWatcher serves a RuleSet loaded from the rule set files (.json, .yaml, .yml, .hcl, .rules) of a directory &
+// reloads it when the files change. Changes are loaded once the modification time & size of every file are unchanged
+// across two polls so files that are still being written aren't loaded. A new RuleSet is only swapped in if every rule
+// of every file compiles; otherwise the previous RuleSet continues to be served.
+type RuleSetWatcher struct {
+	env     *Env
+	dir     string
+	options *watcherOptions
+	current atomic.Value
+	mu      sync.Mutex
+	// observed holds the file states of the last scan & loaded the file states of the last reload
+	observed map[string]fileState
+	loaded   map[string]fileState
+	compiled map[string]*compiledFile
+	done     chan struct{}
+	wg       sync.WaitGroup
+	once     sync.Once
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+type compiledFile struct {
+	state fileState
+	rules *RuleSet
+}
+
+// NewRuleSetWatcher loads the rule set files of the directory using the default Env & watches them for changes
+func NewRuleSetWatcher(dir string, opts ...WatcherOption) (*RuleSetWatcher, error) {
+	if defaultEnvErr != nil {
+		return nil, defaultEnvErr
+	}
+	return defaultEnv.NewRuleSetWatcher(dir, opts...)
+}
+
+// NewRuleSetWatcher loads the rule set files of the directory & watches them for changes. An error is returned
+// if the initial load fails.
+func (e *Env) NewRuleSetWatcher(dir string, opts ...WatcherOption) (*RuleSetWatcher, error) {
+	options := &watcherOptions{
+		interval: time.Second,
+	}
+	for _, o := range opts {
+		o(options)
+	}
+	if options.interval <= 0 {
+		return nil, errors.New("trigger: poll interval must be greater than zero")
+	}
+	w := &RuleSetWatcher{
+		env:      e,
+		dir:      dir,
+		options:  options,
+		observed: map[string]fileState{},
+		loaded:   map[string]fileState{},
+		compiled: map[string]*compiledFile{},
+		done:     make(chan struct{}),
+	}
+	if _, err := w.reload(false); err != nil {
+		return nil, err
+	}
+	w.wg.Add(1)
+	go w.watch()
+	return w, nil
+}
+
+// RuleSet returns the rule set currently being served
+func (w *RuleSetWatcher) RuleSet() *RuleSet {
+	return w.current.Load().(*RuleSet)
+}
+
+// Reload checks the directory for changes immediately & loads them without waiting for the files to settle. It
+// returns nil if nothing changed or the changes were swapped in & the reason the changes were rejected otherwise.
+func (w *RuleSetWatcher) Reload() error {
+	event, err := w.reload(false)
+	if err != nil {
+		return err
+	}
+	if event != nil {
+		w.emit(*event)
+		return event.Err
+	}
+	return nil
+}
+
+// Close stops watching the directory. The last rule set continues to be served.
+func (w *RuleSetWatcher) Close() {
+	w.once.Do(func() {
+		close(w.done)
+	})
+	w.wg.Wait()
+}
+
+func (w *RuleSetWatcher) watch() {
+	defer w.wg.Done()
+	ticker := time.NewTicker(w.options.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			event, err := w.reload(true)
+			if err != nil {
+				event = &ReloadEvent{
+					Time:    time.Now(),
+					RuleSet: w.RuleSet(),
+					Err:     err,
+				}
+			}
+			if event != nil {
+				w.emit(*event)
+			}
+		}
+	}
+}
+
+func (w *RuleSetWatcher) emit(event ReloadEvent) {
+	if w.options.onReload != nil {
+		w.options.onReload(event)
+	}
+}
+
+// reload compiles the files that changed since they were last compiled successfully. If settle is true, changes are
+// only loaded once the files are unchanged since the previous scan. It returns a nil event if there's nothing to load
+// & an error if the directory could not be scanned.
+func (w *RuleSetWatcher) reload(settle bool) (*ReloadEvent, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	states, err := w.scan()
+	if err != nil {
+		return nil, err
+	}
+	settled := len(changedFiles(w.observed, states)) == 0
+	w.observed = states
+	changed := changedFiles(w.loaded, states)
+	if w.current.Load() != nil && (len(changed) == 0 || settle && !settled) {
+		return nil, nil
+	}
+	event := &ReloadEvent{
+		Time:    time.Now(),
+		Changed: changed,
+	}
+	compiled := map[string]*compiledFile{}
+	var errs []*RuleError
+	for path, state := range states {
+		if c, ok := w.compiled[path]; ok && c.state == state {
+			compiled[path] = c
+			continue
+		}
+		rules, err := w.env.LoadRuleSetFile(path)
+		if err != nil {
+			if setErr, ok := err.(*RuleSetError); ok {
+				errs = append(errs, setErr.Errors...)
+			} else {
+				errs = append(errs, &RuleError{File: path, Err: err})
+			}
+			continue
+		}
+		compiled[path] = &compiledFile{
+			state: state,
+			rules: rules,
+		}
+	}
+	if settle {
+		// a file that changed while it was read is loaded once it settles
+		after, err := w.scan()
+		if err != nil {
+			return nil, err
+		}
+		if len(changedFiles(states, after)) > 0 {
+			w.observed = after
+			return nil, nil
+		}
+	}
+	w.loaded = states
+	var set *RuleSet
+	if len(errs) == 0 {
+		set, err = mergeRuleSets(compiled)
+	} else {
+		err = &RuleSetError{Errors: errs}
+	}
+	if err != nil {
+		if w.current.Load() == nil {
+			return nil, err
+		}
+		event.RuleSet = w.RuleSet()
+		event.Err = err
+		return event, nil
+	}
+	w.compiled = compiled
+	w.current.Store(set)
+	event.RuleSet = set
+	return event, nil
+}
+
+// scan returns the state of each rule set file in the directory
+func (w *RuleSetWatcher) scan() (map[string]fileState, error) {
+	infos, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, "trigger: failed to read rule set directory")
+	}
+	states := map[string]fileState{}
+	for _, info := range infos {
+		if info.IsDir() || !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			continue
+		}
+		path := filepath.Join(w.dir, info.Name())
+		if _, err := RuleFormatFromPath(path); err != nil {
+			continue
+		}
+		states[path] = fileState{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		}
+	}
+	return states, nil
+}
+
+func changedFiles(previous, current map[string]fileState) []string {
+	var changed []string
+	for path, state := range current {
+		if prev, ok := previous[path]; !ok || prev != state {
+			changed = append(changed, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			changed = append(changed, path)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// mergeRuleSets combines the rule sets of each file in path order
+func mergeRuleSets(files map[string]*compiledFile) (*RuleSet, error) {
+	var paths []string
+	for path := range files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var (
+		rules []*TriggerRule
+		errs  []*RuleError
+	)
+	ids := map[string]string{}
+	for _, path := range paths {
+		for _, rule := range files[path].rules.rules {
+			if other, ok := ids[rule.ID]; ok {
+				errs = append(errs, &RuleError{
+					File: path,
+					Rule: rule.ID,
+					Err:  errors.Errorf("duplicate rule id, already defined in %s", other),
+				})
+				continue
+			}
+			ids[rule.ID] = path
+			rules = append(rules, rule)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, &RuleSetError{Errors: errs}
+	}
+	return NewRuleSet(rules...)
+}
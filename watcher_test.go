@@ -0,0 +1,154 @@
+package trigger_test
+
+import (
+	"fmt"
+	"github.com/graphikDB/trigger"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRuleSetWatcher(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.yaml")
+	// files are swapped in by rename so the watcher never observes a partial write
+	write := func(src string, modTime time.Time) {
+		tmp := path + ".tmp"
+		if err := ioutil.WriteFile(tmp, []byte(src), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := os.Chtimes(tmp, modTime, modTime); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	now := time.Now()
+	write(`rules:
+  - id: greet
+    decision: "true"
+    mutation: "{'greeting': 'hello'}"
+`, now)
+	events := make(chan trigger.ReloadEvent, 10)
+	watcher, err := trigger.NewRuleSetWatcher(dir,
+		trigger.WithPollInterval(10*time.Millisecond),
+		trigger.WithReloadHandler(func(event trigger.ReloadEvent) {
+			events <- event
+		}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer watcher.Close()
+	if _, ok := watcher.RuleSet().Get("greet"); !ok {
+		t.Fatal("expected greet rule")
+	}
+	next := func() trigger.ReloadEvent {
+		select {
+		case event := <-events:
+			return event
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for reload")
+		}
+		return trigger.ReloadEvent{}
+	}
+
+	// a rule that fails to compile keeps the previous rule set
+	write(`rules:
+  - id: greet
+    decision: "true"
+    mutation: "{'greeting': 'hello'}"
+  - id: broken
+    decision: this.x ==
+    mutation: "{}"
+`, now.Add(time.Minute))
+	event := next()
+	if _, ok := event.Err.(*trigger.RuleSetError); !ok {
+		t.Fatalf("expected a rule set error, got: %v", event.Err)
+	}
+	if watcher.RuleSet().Len() != 1 || event.RuleSet != watcher.RuleSet() {
+		t.Fatal("expected the previous rule set to be served")
+	}
+
+	write(`rules:
+  - id: greet
+    decision: "true"
+    mutation: "{'greeting': 'hello'}"
+  - id: fixed
+    decision: "true"
+    mutation: "{'fixed': true}"
+`, now.Add(2*time.Minute))
+	event = next()
+	if event.Err != nil {
+		t.Fatal(event.Err.Error())
+	}
+	if len(event.Changed) != 1 || event.Changed[0] != path {
+		t.Fatalf("expected %s to have changed, got: %v", path, event.Changed)
+	}
+	if _, ok := watcher.RuleSet().Get("fixed"); !ok {
+		t.Fatal("expected the new rule set to be served")
+	}
+}
+
+func TestRuleSetWatcher_PartialWrite(t *testing.T) {
+	dir, err := ioutil.TempDir("", "rules")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "rules.yaml")
+	rule := func(i int) string {
+		return fmt.Sprintf("  - id: rule%v\n    decision: \"true\"\n    mutation: \"{'rule%v': true}\"\n", i, i)
+	}
+	if err := ioutil.WriteFile(path, []byte("rules:\n"+rule(0)), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	events := make(chan trigger.ReloadEvent, 10)
+	watcher, err := trigger.NewRuleSetWatcher(dir,
+		trigger.WithPollInterval(200*time.Millisecond),
+		trigger.WithReloadHandler(func(event trigger.ReloadEvent) {
+			events <- event
+		}),
+	)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer watcher.Close()
+
+	// rewrite the file in place over several polls. every chunk leaves a valid rule set with fewer rules.
+	const rules = 60
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := f.WriteString("rules:\n"); err != nil {
+		t.Fatal(err.Error())
+	}
+	for i := 0; i < rules; i++ {
+		if _, err := f.WriteString(rule(i)); err != nil {
+			t.Fatal(err.Error())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err.Error())
+	}
+	select {
+	case event := <-events:
+		if event.Err != nil {
+			t.Fatal(event.Err.Error())
+		}
+		if event.RuleSet.Len() != rules {
+			t.Fatalf("expected the complete rule set to be loaded, got %v rules", event.RuleSet.Len())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for reload")
+	}
+}